@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"flag"
+
 	"github.com/sing3demons/go-library-api/internal/books"
 	"github.com/sing3demons/go-library-api/internal/users"
 	"github.com/sing3demons/go-library-api/pkg/kp"
@@ -9,38 +12,37 @@ import (
 )
 
 func main() {
-	p, err := postgres.New()
+	configPath := flag.String("config", "config.yaml", "path of the YAML or JSON config file")
+	flag.Parse()
+
+	cfg, err := kp.LoadConfig(*configPath)
+	if err != nil {
+		panic(err)
+	}
+
+	p, err := postgres.New(cfg.Database.PostgresDSN)
 	if err != nil {
 		panic(err)
 	}
 	// p.Db.Exec("INSERT INTO books (title, author) VALUES ($1, $2)", "The Hobbit", "J.R.R. Tolkien")
 	// p.Db.Exec("INSERT INTO books (title, author) VALUES ($1, $2)", "The Catcher in the Rye", "J.D. Salinger")
-	defer p.Close()
 
-	client := mongo.NewMongo("mongodb://localhost:27017")
+	client := mongo.NewMongo(cfg.Database.MongoURI)
 
-	dbname := "my_database"
 	dbCollection := "users"
-	collection := client.Database(dbname).Collection(dbCollection)
+	collection := client.Database(cfg.Database.MongoDatabase).Collection(dbCollection)
 
 	//
 	logger := kp.NewAppLogger()
-	server := kp.NewApplication(&kp.Config{
-		AppConfig: kp.AppConfig{
-			Port:  "8080",
-			LogKP: true,
-			AppName: "todo",
-			Version: "1.0.0",
-			TracerHost: "localhost:4318",
-		},
-		KafkaConfig: kp.KafkaConfig{
-			Brokers: []string{"localhost:29092"},
-			GroupID: "my-group",
-		},
-	}, logger)
+	server := kp.NewApplication(cfg, logger)
+	server.AddHealthCheck("postgres", kp.PingChecker(p))
+	server.AddHealthCheck("mongo", kp.MongoChecker(client))
+	server.UseOutbox(p, kp.OutboxConfig{})
+	server.OnStop(func(ctx context.Context) error { return p.Close() })
+	server.OnStop(client.Disconnect)
 
 	// Books module
-	bookRepo := books.NewPostgresBookRepository(p)
+	bookRepo := books.NewPostgresBookRepository(p, server)
 	bookSvc := books.NewBookService(bookRepo)
 	bookHandler := books.NewBookHandler(bookSvc)
 	bookHandler.RegisterRoutes(server)
@@ -6,4 +6,26 @@ CREATE TABLE IF NOT EXISTS books (
     author VARCHAR(250) NOT NULL,
     createdAt TIMESTAMPTZ DEFAULT NOW(),
     updatedAt TIMESTAMPTZ DEFAULT NOW()
-);
\ No newline at end of file
+);
+
+-- messages published to Kafka by the outbox relay, see kp.Server.UseOutbox
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    topic TEXT NOT NULL,
+    key TEXT NOT NULL DEFAULT '',
+    headers JSONB,
+    payload BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMPTZ,
+    createdAt TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unsent_idx ON outbox (next_attempt_at) WHERE sent_at IS NULL;
+
+-- IDs of the Kafka messages handled successfully, see postgres.NewProcessedStore
+CREATE TABLE IF NOT EXISTS processed_messages (
+    id TEXT PRIMARY KEY,
+    processedAt TIMESTAMPTZ DEFAULT NOW()
+);
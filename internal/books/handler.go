@@ -14,10 +14,13 @@ func NewBookHandler(svc BookService) *BookHandler {
 	return &BookHandler{svc: svc}
 }
 
-func (h *BookHandler) RegisterRoutes(r kp.IApplication) {
-	r.Get("/books/:id", h.GetBook)
-	r.Post("/books", h.CreateBook)
-	r.Get("/books", h.GetAllBooks)
+// RegisterRoutes mounts the book routes under /api/v1/books. The middlewares
+// (e.g. auth) only apply to this group.
+func (h *BookHandler) RegisterRoutes(r kp.IApplication, middlewares ...kp.Middleware) {
+	g := r.Group("/api/v1/books", middlewares...)
+	g.Get("/:id", h.GetBook)
+	g.Post("/", h.CreateBook)
+	g.Get("/", h.GetAllBooks)
 }
 
 func (h *BookHandler) GetBook(c kp.IContext) error {
@@ -34,10 +37,10 @@ func (h *BookHandler) GetBook(c kp.IContext) error {
 
 	book, err := h.svc.GetBook(c, id)
 	if err != nil {
-		return c.Response(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return kp.Internal(err)
 	}
 	if book == nil {
-		return c.Response(http.StatusNotFound, map[string]any{"error": "book not found"})
+		return kp.NotFound("book not found")
 	}
 	c.SummaryLog().End("200", "")
 	return c.Response(http.StatusOK, book)
@@ -52,18 +55,17 @@ func (h *BookHandler) CreateBook(c kp.IContext) error {
 
 	var req Book
 	if err := c.ReadInput(&req); err != nil {
-		c.SummaryLog().AddError(node, cmd, "", err.Error())
-		return c.Response(http.StatusBadRequest, map[string]any{"error": "invalid request"})
+		return kp.InvalidInput(err)
 	}
 	c.SummaryLog().AddSuccess(node, cmd, "", "success")
 	err := h.svc.CreateBook(c, &req)
 	if err != nil {
-		return c.Response(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return kp.Internal(err)
 	}
 
 	result, err := kp.RequestHttp(c, kp.RequestAttributes{
 		Method: http.MethodGet,
-		URL:    "http://localhost:8080/books/{id}",
+		URL:    "http://localhost:8080/api/v1/books/{id}",
 		Headers: map[string]string{
 			"Content-Type": "application/json",
 		},
@@ -85,8 +87,6 @@ func (h *BookHandler) CreateBook(c kp.IContext) error {
 		})
 	}
 
-	c.SendMessage("book-log", result)
-
 	c.SummaryLog().End("200", "")
 	return c.Response(http.StatusCreated, map[string]any{
 		"message": "book created",
@@ -115,11 +115,7 @@ func (h *BookHandler) GetAllBooks(c kp.IContext) error {
 
 	books, err := h.svc.GetAllBooks(c, filter)
 	if err != nil {
-		msg := map[string]string{
-			"error": err.Error(),
-		}
-		c.SummaryLog().AddError(node, cmd, "", "")
-		return c.Response(http.StatusInternalServerError, msg)
+		return kp.Internal(err)
 	}
 
 	c.SummaryLog().End("200", "")
@@ -3,6 +3,6 @@ package books
 type Book struct {
 	ID     string `json:"id"`
 	Href   string `json:"href,omitempty"`
-	Title  string `json:"title"`
-	Author string `json:"author"`
+	Title  string `json:"title" validate:"required,max=255"`
+	Author string `json:"author" validate:"required,max=255"`
 }
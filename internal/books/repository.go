@@ -17,15 +17,34 @@ type BookRepository interface {
 }
 
 type MongoBookRepository struct {
-	Db postgres.DB
+	Db     postgres.DB
+	codecs Codecs
 }
 
-func NewPostgresBookRepository(db postgres.DB) *MongoBookRepository {
-	return &MongoBookRepository{Db: db}
+// Codecs gives the codec of a Kafka topic, e.g. kp.IApplication.
+type Codecs interface {
+	Codec(topic string) kp.Codec
+}
+
+// NewPostgresBookRepository writes the outbox messages with the codecs of
+// their topics, JSON when codecs is nil.
+func NewPostgresBookRepository(db postgres.DB, codecs Codecs) *MongoBookRepository {
+	return &MongoBookRepository{Db: db, codecs: codecs}
+}
+
+func (r *MongoBookRepository) codec(topic string) kp.Codec {
+	if r.codecs == nil {
+		return nil
+	}
+	return r.codecs.Codec(topic)
 }
 
 const (
 	node_postgres = "postgres"
+
+	// topicBookLog receives a message for every created book, through the
+	// outbox of the insert transaction.
+	topicBookLog = "book-log"
 )
 
 func (r *MongoBookRepository) Save(ctx kp.IContext, book *Book) error {
@@ -43,6 +62,13 @@ func (r *MongoBookRepository) Save(ctx kp.IContext, book *Book) error {
 	result, err := r.Db.CreateBook(c, entities.Book{
 		Title:  book.Title,
 		Author: book.Author,
+	}, func(created entities.Book) (kp.OutboxMessage, error) {
+		return kp.NewOutboxMessage(c, r.codec(topicBookLog), topicBookLog, created.ID, Book{
+			ID:     created.ID,
+			Href:   r.href(created.ID),
+			Title:  created.Title,
+			Author: created.Author,
+		})
 	})
 	ctx.DetailLog().AddOutputRequest(node_postgres, cmd, invoke, result.RawData, result.Body, node_postgres, "")
 
@@ -94,7 +120,7 @@ func (r *MongoBookRepository) GetByID(ctx kp.IContext, id string) (*Book, error)
 }
 
 func (r *MongoBookRepository) href(id string) string {
-	return fmt.Sprintf("/books/%s", id)
+	return fmt.Sprintf("/api/v1/books/%s", id)
 }
 
 func (r *MongoBookRepository) GetALL(ctx kp.IContext, filter map[string]interface{}) ([]*Book, error) {
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sing3demons/go-library-api/pkg/entities"
 	"github.com/sing3demons/go-library-api/pkg/kp"
@@ -27,6 +28,7 @@ type MockDB struct {
 	books      []Book
 	next       bool
 	err        error
+	outbox     []kp.OutboxMessage
 }
 
 var book = Book{
@@ -36,7 +38,7 @@ var book = Book{
 	Href:   "",
 }
 
-func (m *MockDB) CreateBook(ctx context.Context, book entities.Book) (entities.ProcessData[entities.Book], error) {
+func (m *MockDB) CreateBook(ctx context.Context, book entities.Book, events ...postgres.BookEvent) (entities.ProcessData[entities.Book], error) {
 	var result entities.ProcessData[entities.Book]
 
 	result.Body.Collection = "books"
@@ -63,9 +65,29 @@ func (m *MockDB) CreateBook(ctx context.Context, book entities.Book) (entities.P
 
 	result.Data.ID = m.ExpectedID
 
+	for _, event := range events {
+		message, err := event(result.Data)
+		if err != nil {
+			return result, err
+		}
+		m.outbox = append(m.outbox, message)
+	}
+
 	return result, nil
 }
 
+func (m *MockDB) ClaimOutbox(ctx context.Context, limit int) ([]kp.OutboxMessage, error) {
+	return m.outbox, nil
+}
+
+func (m *MockDB) MarkOutboxSent(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockDB) MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, cause error) error {
+	return nil
+}
+
 func (m *MockDB) GetAllBooks(ctx context.Context, filter map[string]any) (result entities.ProcessData[[]entities.Book], err error) {
 	result.Body.Collection = "books"
 	result.Body.Table = "books"
@@ -300,6 +322,10 @@ func (m *MockDB) QueryContext(ctx context.Context, query string, args ...any) (p
 		query:  query,
 	}, nil
 }
+func (m *MockDB) PingContext(ctx context.Context) error {
+	return nil
+}
+
 func (m *MockDB) Close() error {
 	return nil
 }
@@ -370,10 +396,34 @@ func scan(columns []string, data Book, dest ...any) error {
 	return nil
 }
 
+type upperCodec struct{ kp.JSONCodec }
+
+func (upperCodec) Encode(topic string, v any) ([]byte, error) {
+	return []byte(strings.ToUpper(topic)), nil
+}
+
+type stubCodecs map[string]kp.Codec
+
+func (c stubCodecs) Codec(topic string) kp.Codec {
+	return c[topic]
+}
+
 func TestSave(t *testing.T) {
+	t.Run("should encode the outbox message with the codec of its topic", func(t *testing.T) {
+		mockDB := &MockDB{ExpectedID: "123"}
+		repo := NewPostgresBookRepository(mockDB, stubCodecs{topicBookLog: upperCodec{}})
+
+		err := repo.Save(kp.NewMockContext(), &Book{Title: "Dune"})
+
+		assert.NoError(t, err)
+		if assert.Len(t, mockDB.outbox, 1) {
+			assert.Equal(t, "BOOK-LOG", string(mockDB.outbox[0].Payload))
+		}
+	})
+
 	t.Run("should save a book success", func(t *testing.T) {
 		mockDB := &MockDB{ExpectedID: "123", ShouldFail: false}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 
 		ctx := kp.NewMockContext()
 		err := repo.Save(ctx, &book)
@@ -382,18 +432,26 @@ func TestSave(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "123", book.ID)
 
-		expectedHref := "/books/123"
+		expectedHref := "/api/v1/books/123"
 		assert.Equal(t, expectedHref, book.Href)
+
+		if assert.Len(t, mockDB.outbox, 1) {
+			message := mockDB.outbox[0]
+			assert.Equal(t, topicBookLog, message.Topic)
+			assert.Equal(t, "123", message.Key)
+			assert.JSONEq(t, `{"id":"123","href":"/api/v1/books/123","title":"Test Book","author":"Test Author"}`, string(message.Payload))
+		}
 	})
 
 	t.Run("should fail to save a book", func(t *testing.T) {
 		mockDB := &MockDB{ShouldFail: true}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 		ctx := kp.NewMockContext()
 		err := repo.Save(ctx, &book)
 		ctx.Verify(t)
 
 		assert.Error(t, err)
+		assert.Empty(t, mockDB.outbox)
 	})
 }
 
@@ -403,7 +461,7 @@ func TestGetByID(t *testing.T) {
 			ShouldFail: false,
 			book:       &book,
 		}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 
 		book, err := repo.GetByID(kp.NewMockContext(), "123")
 
@@ -413,7 +471,7 @@ func TestGetByID(t *testing.T) {
 
 	t.Run("should fail to get a book by id", func(t *testing.T) {
 		mockDB := &MockDB{ShouldFail: true}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 
 		book, err := repo.GetByID(kp.NewMockContext(), "123")
 
@@ -431,7 +489,7 @@ func TestGetALL(t *testing.T) {
 			next:       true,
 			books:      []Book{{ID: "456", Title: "Test Book 2", Author: "Test Author 2"}},
 		}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 
 		books, err := repo.GetALL(kp.NewMockContext(), nil)
 
@@ -441,7 +499,7 @@ func TestGetALL(t *testing.T) {
 
 	t.Run("should fail to get all books", func(t *testing.T) {
 		mockDB := &MockDB{ShouldFail: true}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 
 		books, err := repo.GetALL(kp.NewMockContext(), nil)
 
@@ -455,7 +513,7 @@ func TestGetALL(t *testing.T) {
 			book:       &book,
 			err:        errors.New(mockDatabaseError),
 		}
-		repo := NewPostgresBookRepository(mockDB)
+		repo := NewPostgresBookRepository(mockDB, nil)
 
 		books, err := repo.GetALL(kp.NewMockContext(), nil)
 
@@ -1,9 +1,6 @@
 package users
 
 import (
-	"net/http"
-
-	"github.com/gofiber/fiber/v2"
 	"github.com/sing3demons/go-library-api/pkg/kp"
 )
 
@@ -15,51 +12,45 @@ func NewUserHandler(svc UserService) *UserHandler {
 	return &UserHandler{svc: svc}
 }
 
+type RegisterUserRequest struct {
+	Name  string `json:"name" validate:"required,max=100"`
+	Email string `json:"email" validate:"required,email"`
+}
+
+type GetUserRequest struct {
+	ID string `param:"id" validate:"required"`
+}
+
 func (h *UserHandler) RegisterRoutes(r kp.IApplication) {
-	r.Post("/users/register", h.RegisterUser)
-	r.Get("/users/:id", h.GetUser)
-	r.Get("/users", h.GetAllUsers)
+	r.Post("/users/register", kp.Created("register_user", "register_user", h.RegisterUser))
+	r.Get("/users/:id", kp.JSON("get_user", "get_user_by_id", h.GetUser))
+	r.Get("/users", kp.JSON("get_all_users", "get_all_users", h.GetAllUsers))
 }
 
-func (h *UserHandler) RegisterUser(c kp.IContext) error {
-	var req struct {
-		Name  string `json:"name"`
-		Email string `json:"email"`
-	}
-	cmd := "register_user"
-	c.CommonLog(cmd, "register_user")
-	if err := c.ReadInput(&req); err != nil {
-		return c.Response(fiber.StatusBadRequest, map[string]any{"error": "invalid request"})
-	}
+func (h *UserHandler) RegisterUser(c kp.IContext, req RegisterUserRequest) (*User, error) {
 	user, err := h.svc.RegisterUser(c, req.Name, req.Email)
 	if err != nil {
-		return c.Response(http.StatusConflict, map[string]any{"error": err.Error()})
+		return nil, kp.Conflict(err.Error()).WithCause(err)
 	}
-	return c.Response(http.StatusCreated, user)
+	return user, nil
 }
 
-func (h *UserHandler) GetUser(c kp.IContext) error {
-	cmd := "get_user"
-
-	c.CommonLog(cmd, "get_user_by_id")
-	id := c.Param("id")
-	book, err := h.svc.GetUserById(c, id)
+func (h *UserHandler) GetUser(c kp.IContext, req GetUserRequest) (*User, error) {
+	user, err := h.svc.GetUserById(c, req.ID)
 	if err != nil {
-		return c.Response(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return nil, kp.Internal(err)
 	}
-	if book == nil {
-		return c.Response(http.StatusNotFound, map[string]any{"error": "book not found"})
+	if user == nil {
+		return nil, kp.NotFound("user not found")
 	}
-	return c.Response(http.StatusOK, book)
+	return user, nil
 }
 
-func (h *UserHandler) GetAllUsers(c kp.IContext) error {
-	cmd := "get_all_users"
-	c.CommonLog(cmd, "get_all_users")
-	c.SummaryLog().AddSuccess("client", cmd, "", "success")
+func (h *UserHandler) GetAllUsers(c kp.IContext, _ struct{}) ([]*User, error) {
+	c.SummaryLog().AddSuccess("client", "get_all_users", "", "success")
 	users, err := h.svc.GetAllUsers(c)
 	if err != nil {
-		return c.Response(http.StatusInternalServerError, map[string]any{"error": err.Error()})
+		return nil, kp.Internal(err)
 	}
-	return c.Response(http.StatusOK, users)
+	return users, nil
 }
@@ -4,12 +4,10 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sing3demons/go-library-api/pkg/kp/logger"
 	"go.opentelemetry.io/otel/sdk/trace"
 )
@@ -22,11 +20,28 @@ type IApplication interface {
 	Patch(path string, handler HandleFunc, middlewares ...Middleware)
 
 	Use(middlewares ...Middleware)
+	Group(prefix string, middlewares ...Middleware) IRouterGroup
+	SetErrorHandler(handler ErrorHandler)
+	AddHealthCheck(name string, checker HealthChecker)
+	NewCounter(name, help string, labels ...string) *prometheus.CounterVec
+	NewGauge(name, help string, labels ...string) *prometheus.GaugeVec
+	OnStart(hook Hook)
+	OnStop(hook Hook)
 	Start()
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 
-	Consume(topic string, handler ServiceHandleFunc)
+	Consume(topic string, handler ServiceHandleFunc, middlewares ...Middleware)
+	ConsumeWithOptions(topic string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware)
+	ConsumePattern(pattern string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) error
+	ConsumeRegexp(expr string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) error
 	SendMessage(topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error)
+	SendMessages(topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error)
+	SendMessageAsync(topic string, payload any, opts ...OptionProducerMsg) error
+	SetCodec(topic string, codec Codec)
+	Codec(topic string) Codec
+	UseOutbox(store OutboxStore, config OutboxConfig)
+	Kafka() *KafkaServer
+	UseKafkaAdmin(middlewares ...Middleware)
 }
 
 type IRouter interface {
@@ -36,27 +51,74 @@ type IRouter interface {
 	Delete(path string, handler HandleFunc, middlewares ...Middleware)
 	Patch(path string, handler HandleFunc, middlewares ...Middleware)
 	Use(middlewares ...Middleware)
+	Group(prefix string, middlewares ...Middleware) IRouterGroup
+	SetErrorHandler(handler ErrorHandler)
 	Register() *http.Server
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type AppConfig struct {
-	AppName    string
-	Version    string
-	Port       string
-	Router     Router
-	LogKP      bool
-	TracerHost string
+	AppName    string `json:"name"`
+	Version    string `json:"version"`
+	Port       string `json:"port" validate:"omitempty,numeric"`
+	Router     Router `json:"router"`
+	LogKP      bool   `json:"logKP"`
+	TracerHost string `json:"tracerHost"`
+
+	// ShutdownTimeout bounds the graceful shutdown, 15s when unset.
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// ShutdownDrainDelay keeps serving after readiness turns false, so the
+	// probes see it and traffic stops before the listener closes.
+	ShutdownDrainDelay Duration `json:"shutdownDrainDelay"`
 }
 
 type KafkaConfig struct {
-	Brokers  []string
-	GroupID  string
-	Username string
-	Password string
+	Brokers  []string `json:"brokers"`
+	GroupID  string   `json:"groupId" validate:"required_with=Brokers"`
+	ClientID string   `json:"clientId"`
+	// Version is the Kafka protocol version, e.g. "3.6.0", 2.5.0 when unset.
+	Version string `json:"version"`
+
+	// SASL is enabled when Username and Password are set, with PLAIN unless
+	// SASLMechanism says otherwise.
+	Username      string    `json:"username" validate:"required_with=Password SASLMechanism"`
+	Password      string    `json:"password" validate:"required_with=Username"`
+	SASLMechanism string    `json:"saslMechanism" validate:"omitempty,oneof=PLAIN SCRAM-SHA-256 SCRAM-SHA-512"`
+	TLS           TLSConfig `json:"tls"`
+
+	Compression       string `json:"compression" validate:"omitempty,oneof=none gzip snappy lz4 zstd"`
+	RequiredAcks      string `json:"requiredAcks" validate:"omitempty,oneof=none leader all"`
+	Idempotent        bool   `json:"idempotent"`
+	RebalanceStrategy string `json:"rebalanceStrategy" validate:"omitempty,oneof=range roundrobin sticky"`
+
+	Async AsyncProducerConfig `json:"async"`
+
+	// TopicRefreshInterval is how often pattern subscriptions look for new
+	// topics, 1m when unset.
+	TopicRefreshInterval Duration `json:"topicRefreshInterval"`
+
+	// ReplyTopic receives the replies to IContext.Request, every instance
+	// reads all of it. Request is disabled when unset.
+	ReplyTopic string `json:"replyTopic"`
+
+	// EnsureTopics are created by NewApplication when they do not exist.
+	EnsureTopics []TopicConfig `json:"ensureTopics" validate:"dive"`
+
+	producer      sarama.SyncProducer
+	consumer      sarama.ConsumerGroup
+	asyncProducer sarama.AsyncProducer
+	async         *asyncProducer
+	codecs        *codecs
+	admin         topicAdmin
+	replies       *replyConsumer
+}
 
-	producer sarama.SyncProducer
-	consumer sarama.ConsumerGroup
+// codec is the codec of topic, JSONCodec unless SetCodec replaced it.
+func (c *KafkaConfig) codec(topic string) Codec {
+	if c == nil {
+		return JSONCodec{}
+	}
+	return c.codecs.forTopic(topic)
 }
 
 type KafkaProducerOptions struct {
@@ -64,12 +126,22 @@ type KafkaProducerOptions struct {
 	ReturnErrors    bool
 }
 
+// DatabaseConfig holds the connection settings of the databases the service
+// talks to, see postgres.New and mongo.NewMongo.
+type DatabaseConfig struct {
+	PostgresDSN   string `json:"postgresDsn"`
+	MongoURI      string `json:"mongoUri" validate:"omitempty,uri"`
+	MongoDatabase string `json:"mongoDatabase" validate:"required_with=MongoURI"`
+}
+
 type Config struct {
-	AppConfig   AppConfig
-	KafkaConfig KafkaConfig
+	AppConfig   AppConfig        `json:"app"`
+	KafkaConfig KafkaConfig      `json:"kafka"`
+	LogConfig   logger.LogConfig `json:"log"`
+	Database    DatabaseConfig   `json:"database"`
 }
 
-// enum Router {gin, mux}
+// enum Router {gin, mux, echo, fiber}, None falls back to gin
 type Router int
 
 const (
@@ -84,12 +156,20 @@ type Server struct {
 	httpServer    *http.Server
 	kafka         *KafkaServer
 	router        IRouter
+	handler       http.Handler
 	Log           ILogger
 	traceProvider *trace.TracerProvider
+	health        *health
+	outbox        *outboxRelay
+
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	onStart         []Hook
+	onStop          []Hook
 }
 
 func NewApplication(config *Config, nLog ILogger) IApplication {
-	kafka := &KafkaServer{}
+	kafka := &KafkaServer{options: &config.KafkaConfig, log: nLog}
 
 	if len(config.KafkaConfig.Brokers) != 0 {
 		producer, err := newProducer(&config.KafkaConfig)
@@ -106,6 +186,29 @@ func NewApplication(config *Config, nLog ILogger) IApplication {
 			log.Fatalf("Failed to create Kafka server: %v", err)
 		}
 
+		if config.KafkaConfig.Async.Enabled {
+			asyncProducer, err := newAsyncSaramaProducer(&config.KafkaConfig)
+			if err != nil {
+				log.Fatalf("Failed to create Kafka async producer: %v", err)
+			}
+			k.async = newAsyncProducer(asyncProducer, config.KafkaConfig.Async)
+			config.KafkaConfig.async = k.async
+		}
+
+		if len(config.KafkaConfig.EnsureTopics) != 0 {
+			if err := k.EnsureTopics(config.KafkaConfig.EnsureTopics...); err != nil {
+				log.Fatalf("Failed to ensure Kafka topics: %v", err)
+			}
+		}
+
+		if config.KafkaConfig.ReplyTopic != "" {
+			replies, err := newReplyConsumer(&config.KafkaConfig, nLog)
+			if err != nil {
+				log.Fatalf("Failed to create Kafka reply consumer: %v", err)
+			}
+			config.KafkaConfig.replies = replies
+		}
+
 		kafka = k
 	}
 
@@ -120,103 +223,103 @@ func NewApplication(config *Config, nLog ILogger) IApplication {
 	}
 
 	var router IRouter
+	health := newHealth()
+	if len(config.KafkaConfig.Brokers) != 0 {
+		health.add("kafka", kafka)
+	}
 
 	if config.AppConfig.Port != "" {
 		if kafka != nil {
 			config.KafkaConfig.producer = kafka.producer
 		}
 		switch config.AppConfig.Router {
-		// case Gin:
-		// 	router = newGinServer(config, logger)
-		// case Echo:
-		// 	router = newEchoServer(config, logger)
+		case Mux:
+			router = newMuxServer(config, nLog)
+		case Echo:
+			router = newEchoServer(config, nLog)
+		case Fiber:
+			router = newFiberServer(config, nLog)
 		default:
 			router = newServer(config, nLog)
 		}
 	}
 
 	if config.AppConfig.LogKP {
-		logger.LoadLogConfig(logger.LogConfig{
-			Summary: logger.SummaryLogConfig{
-				LogFile:    true,
-				LogConsole: true,
-			},
-			Detail: logger.DetailLogConfig{
-				LogFile: true,
-			},
-		})
+		logConfig := config.LogConfig
+		if logConfig == (logger.LogConfig{}) {
+			logConfig = logger.LogConfig{
+				Summary: logger.SummaryLogConfig{
+					LogFile:    true,
+					LogConsole: true,
+				},
+				Detail: logger.DetailLogConfig{
+					LogFile: true,
+				},
+			}
+		}
+		logger.LoadLogConfig(logConfig)
+	}
+
+	var handler http.Handler
+	if router != nil {
+		handler = metricsHandler(health.handler(router))
 	}
 
 	return &Server{
-		kafka:         kafka,
-		router:        router,
-		Log:           nLog,
-		traceProvider: traceProvider,
+		kafka:           kafka,
+		router:          router,
+		handler:         handler,
+		Log:             nLog,
+		traceProvider:   traceProvider,
+		health:          health,
+		shutdownTimeout: time.Duration(config.AppConfig.ShutdownTimeout),
+		drainDelay:      time.Duration(config.AppConfig.ShutdownDrainDelay),
 	}
 }
 
-func (s *Server) Start() {
-	if s.router != nil {
-		s.httpServer = s.router.Register()
-	}
+func (s *Server) Consume(topic string, handler ServiceHandleFunc, middlewares ...Middleware) {
+	s.kafka.Consume(topic, handler, middlewares...)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer cancel()
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
-
-	if s.httpServer != nil {
-		// Start HTTP Server
-		go func() {
-			s.Log.Println("Starting HTTP server on " + s.httpServer.Addr)
-			if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				s.Log.Printf("HTTP Server Error: %v", err)
-				os.Exit(1)
-			}
-		}()
-	}
+func (s *Server) ConsumeWithOptions(topic string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) {
+	s.kafka.ConsumeWithOptions(topic, opts, handler, middlewares...)
+}
 
-	if s.kafka != nil {
-		// Start Kafka Consumer
-		go func() {
-			s.Log.Println("Starting Kafka consumer...")
-			if err := s.kafka.StartConsumer(ctx); err != nil {
-				s.Log.Printf("Kafka consumer error: %v", err)
-			}
-		}()
-	}
+func (s *Server) ConsumePattern(pattern string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) error {
+	return s.kafka.ConsumePattern(pattern, opts, handler, middlewares...)
+}
 
-	// Wait for termination signal
-	<-signalChan
-	s.Log.Println("Shutdown signal received")
+func (s *Server) ConsumeRegexp(expr string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) error {
+	return s.kafka.ConsumeRegexp(expr, opts, handler, middlewares...)
+}
 
-	if s.kafka != nil {
-		s.kafka.Shutdown()
-	}
+// SetCodec replaces JSONCodec for the messages of topic, see Codec.
+func (s *Server) SetCodec(topic string, codec Codec) {
+	s.kafka.SetCodec(topic, codec)
+}
 
-	if err := s.httpServer.Shutdown(ctx); err != nil {
-		s.Log.Printf("HTTP Server Shutdown Error: %v", err)
-	} else {
-		s.Log.Println("HTTP server shutdown complete")
-	}
+// Codec returns the codec of topic, e.g. for NewOutboxMessage.
+func (s *Server) Codec(topic string) Codec {
+	return s.kafka.Codec(topic)
+}
 
-	if s.traceProvider != nil {
-		defer func() {
-			if err := s.traceProvider.Shutdown(ctx); err != nil {
-				s.Log.Println("failed to stop trace provider:", err)
-			}
-		}()
-	}
+// Kafka returns the Kafka server, e.g. for its topic admin helpers.
+func (s *Server) Kafka() *KafkaServer {
+	return s.kafka
+}
 
-	s.Log.Println("Application exited cleanly")
+func (s *Server) SendMessage(topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error) {
+	return producer(context.Background(), s.kafka.producer, s.kafka.options.codec(topic), topic, payload, opts...)
 }
 
-func (s *Server) Consume(topic string, handler ServiceHandleFunc) {
-	s.kafka.Consume(topic, handler)
+// SendMessages publishes the payloads in one batch, see IContext.SendMessages.
+func (s *Server) SendMessages(topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error) {
+	return sendMessages(context.Background(), s.kafka.producer, s.kafka.options.codec(topic), topic, payloads, opts...)
 }
 
-func (s *Server) SendMessage(topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error) {
-	return producer(s.kafka.producer, topic, payload, opts...)
+// SendMessageAsync queues the payload on the async producer, see IContext.SendMessageAsync.
+func (s *Server) SendMessageAsync(topic string, payload any, opts ...OptionProducerMsg) error {
+	return s.kafka.SendMessageAsync(context.Background(), topic, payload, opts...)
 }
 
 func (s *Server) Get(path string, handler HandleFunc, middlewares ...Middleware) {
@@ -243,6 +346,21 @@ func (s *Server) Use(middlewares ...Middleware) {
 	s.router.Use(middlewares...)
 }
 
+func (s *Server) Group(prefix string, middlewares ...Middleware) IRouterGroup {
+	return s.router.Group(prefix, middlewares...)
+}
+
+// SetErrorHandler replaces DefaultErrorHandler for errors returned by HTTP handlers.
+func (s *Server) SetErrorHandler(handler ErrorHandler) {
+	s.router.SetErrorHandler(handler)
+}
+
+// AddHealthCheck adds a dependency to /health/ready. The endpoint answers 503
+// while any checker fails or the server is shutting down.
+func (s *Server) AddHealthCheck(name string, checker HealthChecker) {
+	s.health.add(name, checker)
+}
+
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.router.ServeHTTP(w, r)
+	s.handler.ServeHTTP(w, r)
 }
@@ -0,0 +1,208 @@
+package kp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec serializes the messages of a topic. JSONCodec is used for topics
+// without a codec, see IApplication.SetCodec.
+type Codec interface {
+	Encode(topic string, v any) ([]byte, error)
+	Decode(topic string, data []byte, v any) error
+}
+
+// JSONCodec encodes messages with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(_ string, v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Decode(_ string, data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes proto.Message values. With a Registry the message is
+// framed with the Confluent wire header and Schema, the .proto source of the
+// message, is registered under the "<topic>-value" subject.
+type ProtobufCodec struct {
+	Registry *SchemaRegistry
+	Schema   string
+}
+
+func (c ProtobufCodec) Encode(topic string, v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	if c.Registry == nil {
+		return data, nil
+	}
+
+	id, err := c.Registry.Register(SubjectName(topic), c.Schema, SchemaTypeProtobuf)
+	if err != nil {
+		return nil, err
+	}
+	// the message index [0], the first message of the schema
+	return appendWireHeader(id, append([]byte{0}, data...)), nil
+}
+
+func (c ProtobufCodec) Decode(_ string, data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+
+	if c.Registry != nil {
+		_, payload, err := readWireHeader(data)
+		if err != nil {
+			return err
+		}
+		if data, err = skipMessageIndexes(payload); err != nil {
+			return err
+		}
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// AvroCodec encodes values with the Avro Schema. With a Registry the schema
+// is registered under the "<topic>-value" subject, messages are framed with
+// the Confluent wire header and decoded with the schema they were written with.
+type AvroCodec struct {
+	Registry *SchemaRegistry
+	Schema   string
+}
+
+func (c AvroCodec) Encode(topic string, v any) ([]byte, error) {
+	schema, err := parseAvroSchema(c.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := avro.Marshal(schema, v)
+	if err != nil {
+		return nil, err
+	}
+	if c.Registry == nil {
+		return data, nil
+	}
+
+	id, err := c.Registry.Register(SubjectName(topic), c.Schema, SchemaTypeAvro)
+	if err != nil {
+		return nil, err
+	}
+	return appendWireHeader(id, data), nil
+}
+
+func (c AvroCodec) Decode(_ string, data []byte, v any) error {
+	source := c.Schema
+	if c.Registry != nil {
+		id, payload, err := readWireHeader(data)
+		if err != nil {
+			return err
+		}
+		if source, err = c.Registry.Schema(id); err != nil {
+			return err
+		}
+		data = payload
+	}
+
+	schema, err := parseAvroSchema(source)
+	if err != nil {
+		return err
+	}
+	return avro.Unmarshal(schema, data, v)
+}
+
+var avroSchemas sync.Map
+
+func parseAvroSchema(source string) (avro.Schema, error) {
+	if schema, ok := avroSchemas.Load(source); ok {
+		return schema.(avro.Schema), nil
+	}
+	schema, err := avro.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("avro codec: %w", err)
+	}
+	avroSchemas.Store(source, schema)
+	return schema, nil
+}
+
+// wireMagicByte starts every message framed with a schema ID.
+const wireMagicByte = 0
+
+// ErrInvalidWireFormat is returned when a message does not start with the
+// Confluent wire header: the magic byte and a 4 byte schema ID.
+var ErrInvalidWireFormat = errors.New("message is not in the schema registry wire format")
+
+func appendWireHeader(id int, payload []byte) []byte {
+	data := make([]byte, 5, 5+len(payload))
+	data[0] = wireMagicByte
+	binary.BigEndian.PutUint32(data[1:5], uint32(id))
+	return append(data, payload...)
+}
+
+func readWireHeader(data []byte) (int, []byte, error) {
+	if len(data) < 5 || data[0] != wireMagicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), data[5:], nil
+}
+
+// skipMessageIndexes drops the protobuf message indexes that follow the wire
+// header: a zigzag varint count and that many indexes, or a single 0 for [0].
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 {
+		return nil, ErrInvalidWireFormat
+	}
+	data = data[n:]
+	for i := int64(0); i < count; i++ {
+		if _, n = binary.Varint(data); n <= 0 {
+			return nil, ErrInvalidWireFormat
+		}
+		data = data[n:]
+	}
+	return data, nil
+}
+
+// codecs holds the codec of every topic that does not use JSONCodec.
+type codecs struct {
+	mu     sync.RWMutex
+	topics map[string]Codec
+}
+
+func newCodecs() *codecs {
+	return &codecs{topics: make(map[string]Codec)}
+}
+
+func (c *codecs) set(topic string, codec Codec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics[topic] = codec
+}
+
+func (c *codecs) forTopic(topic string) Codec {
+	if c == nil {
+		return JSONCodec{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if codec, ok := c.topics[topic]; ok {
+		return codec
+	}
+	return JSONCodec{}
+}
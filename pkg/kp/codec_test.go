@@ -0,0 +1,127 @@
+package kp
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const orderSchema = `{
+	"type": "record",
+	"name": "Order",
+	"fields": [
+		{"name": "id", "type": "string"},
+		{"name": "amount", "type": "long"}
+	]
+}`
+
+type avroOrder struct {
+	ID     string `avro:"id"`
+	Amount int64  `avro:"amount"`
+}
+
+func TestJSONCodec(t *testing.T) {
+	data, err := JSONCodec{}.Encode("orders", map[string]string{"id": "1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"1"}`, string(data))
+
+	var out map[string]string
+	assert.NoError(t, JSONCodec{}.Decode("orders", data, &out))
+	assert.Equal(t, "1", out["id"])
+}
+
+func TestAvroCodecWithRegistry(t *testing.T) {
+	fake := newFakeRegistry(t)
+	codec := AvroCodec{Registry: NewSchemaRegistry(fake.URL), Schema: orderSchema}
+
+	data, err := codec.Encode("orders", avroOrder{ID: "a-1", Amount: 42})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0), data[0])
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(data[1:5]))
+
+	// a consumer with an empty cache fetches the writer schema by ID
+	reader := AvroCodec{Registry: NewSchemaRegistry(fake.URL)}
+	var out avroOrder
+	assert.NoError(t, reader.Decode("orders", data, &out))
+	assert.Equal(t, avroOrder{ID: "a-1", Amount: 42}, out)
+}
+
+func TestAvroCodecWithoutRegistry(t *testing.T) {
+	codec := AvroCodec{Schema: orderSchema}
+
+	data, err := codec.Encode("orders", avroOrder{ID: "a-1", Amount: 42})
+	assert.NoError(t, err)
+
+	var out avroOrder
+	assert.NoError(t, codec.Decode("orders", data, &out))
+	assert.Equal(t, int64(42), out.Amount)
+}
+
+func TestAvroCodecRejectsMissingHeader(t *testing.T) {
+	codec := AvroCodec{Registry: NewSchemaRegistry("http://localhost:0"), Schema: orderSchema}
+
+	var out avroOrder
+	assert.ErrorIs(t, codec.Decode("orders", []byte{1, 2}, &out), ErrInvalidWireFormat)
+}
+
+func TestProtobufCodecWithRegistry(t *testing.T) {
+	fake := newFakeRegistry(t)
+	codec := ProtobufCodec{Registry: NewSchemaRegistry(fake.URL), Schema: `syntax = "proto3"; message StringValue { string value = 1; }`}
+
+	data, err := codec.Encode("names", wrapperspb.String("gopher"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 1, 0}, data[:6])
+
+	var out wrapperspb.StringValue
+	assert.NoError(t, codec.Decode("names", data, &out))
+	assert.Equal(t, "gopher", out.GetValue())
+
+	_, err = codec.Encode("names", "not a message")
+	assert.Error(t, err)
+}
+
+func TestProducerUsesTopicCodec(t *testing.T) {
+	fake := newFakeRegistry(t)
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithCheckerFunctionAndSucceed(func(val []byte) error {
+		assert.Equal(t, byte(0), val[0])
+		return nil
+	})
+
+	server := &KafkaServer{producer: mockProducer, log: NewMockLogger()}
+	server.SetCodec("orders", AvroCodec{Registry: NewSchemaRegistry(fake.URL), Schema: orderSchema})
+
+	_, err := server.SendMessage(context.Background(), "orders", avroOrder{ID: "a-1", Amount: 1})
+	assert.NoError(t, err)
+}
+
+func TestConsumerDecodesRetryTopicWithOriginCodec(t *testing.T) {
+	fake := newFakeRegistry(t)
+	codec := AvroCodec{Registry: NewSchemaRegistry(fake.URL), Schema: orderSchema}
+	data, err := codec.Encode("orders", avroOrder{ID: "a-1", Amount: 7})
+	assert.NoError(t, err)
+
+	var got []avroOrder
+	server := &KafkaServer{log: NewMockLogger()}
+	server.SetCodec("orders", codec)
+	server.ConsumeWithOptions("orders", ConsumerOptions{RetryTopics: RetryTopics("orders", 1)}, func(ctx IContext) error {
+		var order avroOrder
+		if err := ctx.ReadInput(&order); err != nil {
+			return err
+		}
+		got = append(got, order)
+		return nil
+	})
+
+	_, err = consumeMessages(server,
+		&sarama.ConsumerMessage{Topic: "orders", Value: data},
+		&sarama.ConsumerMessage{Topic: "orders.retry.1", Value: data},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []avroOrder{{ID: "a-1", Amount: 7}, {ID: "a-1", Amount: 7}}, got)
+}
@@ -0,0 +1,213 @@
+package kp
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables read by LoadConfig.
+const EnvPrefix = "KP_"
+
+// LoadConfig reads the YAML or JSON file at path and overlays the environment
+// variables on top of it. An empty path reads the environment only.
+//
+// Keys follow the json tags of Config. An environment variable is the path of
+// a key in upper snake case, e.g. kafka.groupId is KP_KAFKA_GROUP_ID. Lists
+// are comma separated: KP_KAFKA_BROKERS=broker1:9092,broker2:9092.
+func LoadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+
+	if path != "" {
+		if err := readConfigFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(reflect.ValueOf(cfg).Elem(), strings.TrimSuffix(EnvPrefix, "_")); err != nil {
+		return nil, err
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
+}
+
+func readConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		// decode into plain values first so the json tags are the only
+		// field names a config file has to follow
+		var raw map[string]any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("parse config %s: %w", path, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return fmt.Errorf("parse config %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s, use .yaml, .yml or .json", path)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv sets every field of v that has an environment variable named after
+// prefix and the json tag of the field.
+func loadEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := prefix + "_" + envName(name)
+
+		fv := v.Field(i)
+		if _, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); !ok && fv.Kind() == reflect.Struct {
+			if err := loadEnv(fv, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(fv, value); err != nil {
+			return fmt.Errorf("env %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setEnvValue(field reflect.Value, value string) error {
+	if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(value))
+	}
+
+	switch field.Kind() {
+	case reflect.Ptr:
+		return nil
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", field.Type())
+		}
+		var values []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				values = append(values, s)
+			}
+		}
+		field.Set(reflect.ValueOf(values))
+		return nil
+	default:
+		return setValue(field, value)
+	}
+}
+
+// envName converts a json key to upper snake case, "groupId" -> "GROUP_ID".
+func envName(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func validateConfig(cfg *Config) error {
+	var fields []FieldError
+	if err := Validate(cfg); err != nil {
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		fields = ve.Fields
+	}
+
+	if cfg.AppConfig.Port == "" && len(cfg.KafkaConfig.Brokers) == 0 {
+		fields = append(fields, FieldError{
+			Field:   "app.port",
+			Tag:     "required_without",
+			Param:   "kafka.brokers",
+			Message: "app.port or kafka.brokers is required",
+		})
+	}
+	fields = append(fields, cfg.KafkaConfig.fieldErrors()...)
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// Duration is a time.Duration read from a config file or environment variable
+// as a string such as "15s" or "1m30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = 0
+		return nil
+	}
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// UnmarshalText parses the name of a router: gin, mux, echo or fiber.
+func (r *Router) UnmarshalText(text []byte) error {
+	switch strings.ToLower(string(text)) {
+	case "":
+		*r = None
+	case "gin":
+		*r = Gin
+	case "mux":
+		*r = Mux
+	case "echo":
+		*r = Echo
+	case "fiber":
+		*r = Fiber
+	default:
+		return fmt.Errorf("unknown router %q, use gin, mux, echo or fiber", text)
+	}
+	return nil
+}
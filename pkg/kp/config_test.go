@@ -0,0 +1,141 @@
+package kp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+app:
+  name: library
+  port: "8080"
+  router: echo
+  shutdownTimeout: 20s
+  shutdownDrainDelay: 3s
+kafka:
+  brokers: [localhost:29092]
+  groupId: my-group
+  ensureTopics:
+    - name: book-log
+      partitions: 3
+      retention: 72h
+log:
+  projectName: library
+  appLog:
+    logLevel: debug
+database:
+  mongoUri: mongodb://localhost:27017
+  mongoDatabase: library
+`)
+
+	cfg, err := LoadConfig(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "library", cfg.AppConfig.AppName)
+	assert.Equal(t, "8080", cfg.AppConfig.Port)
+	assert.Equal(t, Echo, cfg.AppConfig.Router)
+	assert.Equal(t, Duration(20*time.Second), cfg.AppConfig.ShutdownTimeout)
+	assert.Equal(t, Duration(3*time.Second), cfg.AppConfig.ShutdownDrainDelay)
+	assert.Equal(t, []string{"localhost:29092"}, cfg.KafkaConfig.Brokers)
+	assert.Equal(t, "my-group", cfg.KafkaConfig.GroupID)
+	assert.Equal(t, []TopicConfig{{Name: "book-log", Partitions: 3, Retention: Duration(72 * time.Hour)}}, cfg.KafkaConfig.EnsureTopics)
+	assert.Equal(t, "library", cfg.LogConfig.ProjectName)
+	assert.Equal(t, zapcore.DebugLevel, cfg.LogConfig.AppLog.LogLevel)
+	assert.Equal(t, "library", cfg.Database.MongoDatabase)
+}
+
+func TestLoadConfigJSONWithEnv(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"app":{"port":"8080"},"database":{"postgresDsn":"host=localhost"}}`)
+	t.Setenv("KP_APP_PORT", "9090")
+	t.Setenv("KP_APP_ROUTER", "fiber")
+	t.Setenv("KP_APP_LOG_KP", "true")
+	t.Setenv("KP_KAFKA_BROKERS", "broker1:9092, broker2:9092")
+	t.Setenv("KP_KAFKA_GROUP_ID", "group")
+	t.Setenv("KP_APP_SHUTDOWN_TIMEOUT", "1m")
+	t.Setenv("KP_LOG_DETAIL_RAW_DATA", "true")
+	t.Setenv("KP_DATABASE_POSTGRES_DSN", "host=db")
+
+	cfg, err := LoadConfig(path)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "9090", cfg.AppConfig.Port)
+	assert.Equal(t, Fiber, cfg.AppConfig.Router)
+	assert.True(t, cfg.AppConfig.LogKP)
+	assert.Equal(t, []string{"broker1:9092", "broker2:9092"}, cfg.KafkaConfig.Brokers)
+	assert.Equal(t, "group", cfg.KafkaConfig.GroupID)
+	assert.Equal(t, Duration(time.Minute), cfg.AppConfig.ShutdownTimeout)
+	assert.True(t, cfg.LogConfig.Detail.RawData)
+	assert.Equal(t, "host=db", cfg.Database.PostgresDSN)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		env    map[string]string
+		fields []string
+	}{
+		{name: "nothing to serve", fields: []string{"app.port"}},
+		{name: "group id", env: map[string]string{"KP_KAFKA_BROKERS": "localhost:9092"}, fields: []string{"kafka.groupId"}},
+		{name: "mongo database", env: map[string]string{"KP_APP_PORT": "8080", "KP_DATABASE_MONGO_URI": "mongodb://localhost"}, fields: []string{"database.mongoDatabase"}},
+		{name: "port", env: map[string]string{"KP_APP_PORT": "http"}, fields: []string{"app.port"}},
+		{name: "sasl mechanism", env: map[string]string{"KP_APP_PORT": "8080", "KP_KAFKA_SASL_MECHANISM": "GSSAPI"}, fields: []string{"kafka.username", "kafka.saslMechanism"}},
+		{name: "password", env: map[string]string{"KP_APP_PORT": "8080", "KP_KAFKA_USERNAME": "user"}, fields: []string{"kafka.password"}},
+		{name: "tls", env: map[string]string{"KP_APP_PORT": "8080", "KP_KAFKA_TLS_CERT_FILE": "client.pem"}, fields: []string{"kafka.tls.enabled", "kafka.tls.keyFile"}},
+		{name: "idempotent", env: map[string]string{"KP_APP_PORT": "8080", "KP_KAFKA_IDEMPOTENT": "true", "KP_KAFKA_REQUIRED_ACKS": "leader", "KP_KAFKA_VERSION": "0.10.2.0"}, fields: []string{"kafka.requiredAcks", "kafka.version"}},
+		{name: "version", env: map[string]string{"KP_APP_PORT": "8080", "KP_KAFKA_VERSION": "latest"}, fields: []string{"kafka.version"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			_, err := LoadConfig(tt.path)
+
+			var ve *ValidationError
+			if assert.True(t, errors.As(err, &ve), err) {
+				var fields []string
+				for _, f := range ve.Fields {
+					fields = append(fields, f.Field)
+				}
+				assert.Equal(t, tt.fields, fields)
+			}
+		})
+	}
+}
+
+func TestLoadConfigInvalidInput(t *testing.T) {
+	_, err := LoadConfig(writeConfigFile(t, "config.toml", ""))
+	assert.ErrorContains(t, err, "unsupported config file")
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "read config")
+
+	t.Setenv("KP_APP_ROUTER", "chi")
+	_, err = LoadConfig("")
+	assert.ErrorContains(t, err, "KP_APP_ROUTER")
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "GROUP_ID", envName("groupId"))
+	assert.Equal(t, "LOG_KP", envName("logKP"))
+	assert.Equal(t, "POSTGRES_DSN", envName("postgresDsn"))
+	assert.Equal(t, "APP_LOG", envName("appLog"))
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -12,16 +14,39 @@ import (
 	"go.opentelemetry.io/otel"
 )
 
+// IKafkaContext is the IContext of a consumer handler. It exposes the record
+// the handler was called for:
+//
+//	if m, ok := ctx.(kp.IKafkaContext); ok {
+//		ctx.Log().Infof("offset %d of %s", m.Offset(), m.Topic())
+//	}
+type IKafkaContext interface {
+	IContext
+	Topic() string
+	Key() string
+	Partition() int32
+	Offset() int64
+	Timestamp() time.Time
+	Headers() map[string]string
+}
+
 type kafkaContext struct {
-	topic    string
-	headers  map[string]string
-	body     string
-	producer sarama.SyncProducer
-	Logger   ILogger
-	ctx      context.Context
+	topic     string
+	key       string
+	partition int32
+	offset    int64
+	timestamp time.Time
+	headers   map[string]string
+	body      string
+	producer  sarama.SyncProducer
+	async     *asyncProducer
+	options   *KafkaConfig
+	codec     Codec
+	Logger    ILogger
+	ctx       context.Context
+	written   bool
 
-	handlers []HandleFunc
-	index    int
+	handlerChain
 
 	detailLog  logger.DetailLog
 	summaryLog logger.SummaryLog
@@ -40,33 +65,51 @@ func newConsumer(option *KafkaConfig) (sarama.ConsumerGroup, error) {
 	if option.consumer != nil {
 		return option.consumer, nil
 	}
-	config := sarama.NewConfig()
-	config.Consumer.Group.Rebalance.Strategy = sarama.NewBalanceStrategyRange()
+	config, err := option.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 	config.Consumer.Offsets.Initial = sarama.OffsetOldest
-	config.Version = sarama.V2_5_0_0     // Ensure Kafka version compatibility
 	config.Consumer.Return.Errors = true // Capture errors from Kafka
 
-	if option.Username != "" && option.Password != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = option.Username
-		config.Net.SASL.Password = option.Password
-	}
-
 	return sarama.NewConsumerGroup(option.Brokers, option.GroupID, config)
 }
 
 // NewConsumerContext creates a new Kafka context for consumer
 func NewConsumerContext(topic, body string, producer sarama.SyncProducer, log ILogger) IContext {
-	ctx := InitSession(context.Background(), log)
-	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx, "kafka-consumer-"+topic)
-	defer span.End()
+	return NewMessageContext(&sarama.ConsumerMessage{Topic: topic, Value: []byte(body)}, producer, log)
+}
+
+// NewMessageContext creates the consumer context of a record, keeping its key,
+// headers, partition, offset and timestamp. The context continues the trace
+// of the record headers.
+func NewMessageContext(message *sarama.ConsumerMessage, producer sarama.SyncProducer, log ILogger) IKafkaContext {
+	return newMessageContext(extractTrace(context.Background(), recordHeaders(message.Headers)), message, producer, log)
+}
+
+func newMessageContext(ctx context.Context, message *sarama.ConsumerMessage, producer sarama.SyncProducer, log ILogger) *kafkaContext {
 	return &kafkaContext{
-		topic:    topic,
-		body:     body,
-		producer: producer,
-		Logger:   log,
-		ctx:      ctx,
+		topic:     message.Topic,
+		key:       string(message.Key),
+		partition: message.Partition,
+		offset:    message.Offset,
+		timestamp: message.Timestamp,
+		headers:   recordHeaders(message.Headers),
+		body:      string(message.Value),
+		producer:  producer,
+		Logger:    log,
+		ctx:       InitSession(ctx, log),
+	}
+}
+
+func recordHeaders(recordHeaders []*sarama.RecordHeader) map[string]string {
+	headers := make(map[string]string, len(recordHeaders))
+	for _, h := range recordHeaders {
+		if h != nil {
+			headers[string(h.Key)] = string(h.Value)
+		}
 	}
+	return headers
 }
 
 func (c *kafkaContext) Context() context.Context {
@@ -100,33 +143,82 @@ func (ctx *kafkaContext) SetHeader(key, value string) {
 	ctx.headers[key] = value
 }
 
+// GetHeader returns a record header, the key is matched case-insensitively
+// when there is no exact match.
 func (ctx *kafkaContext) GetHeader(key string) string {
-	if ctx.headers == nil {
-		return ""
+	if value, ok := ctx.headers[key]; ok {
+		return value
 	}
-	return ctx.headers[key]
+	for k, value := range ctx.headers {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+func (ctx *kafkaContext) Topic() string {
+	return ctx.topic
+}
+
+func (ctx *kafkaContext) Key() string {
+	return ctx.key
+}
+
+func (ctx *kafkaContext) Partition() int32 {
+	return ctx.partition
+}
+
+func (ctx *kafkaContext) Offset() int64 {
+	return ctx.offset
+}
+
+func (ctx *kafkaContext) Timestamp() time.Time {
+	return ctx.timestamp
 }
 
-func (ctx *kafkaContext) Next() {
-	// implementation for Kafka consumer context
-	ctx.index++
-	if ctx.index < len(ctx.handlers) {
-		ctx.handlers[ctx.index](ctx)
+// Headers returns a copy of the record headers.
+func (ctx *kafkaContext) Headers() map[string]string {
+	headers := make(map[string]string, len(ctx.headers))
+	for k, v := range ctx.headers {
+		headers[k] = v
 	}
+	return headers
 }
 
-func (ctx *kafkaContext) SetHandlers(h []HandleFunc) {
-	ctx.handlers = h
-	ctx.index = -1
+func (ctx *kafkaContext) Next() error {
+	return ctx.run(ctx)
+}
+
+// Written reports whether the handler chain has already responded.
+func (ctx *kafkaContext) Written() bool {
+	return ctx.written
 }
 
 func (c *kafkaContext) CommonLog(cmd, scenario string) {
-	initInvoke := c.GetHeader("x-request-id")
+	initInvoke := c.GetHeader(XRequestID)
 	if initInvoke == "" {
 		initInvoke = GenerateXTid("clnt")
 	}
 	detailLog, summaryLog := c.Log().NewLog(c.ctx, initInvoke, scenario)
 
+	var body any = c.body
+	var value any
+	if err := json.Unmarshal([]byte(c.body), &value); err == nil {
+		body = value
+	}
+	inComing := map[string]any{
+		"topic":     c.topic,
+		"key":       c.key,
+		"partition": c.partition,
+		"offset":    c.offset,
+		"headers":   c.headers,
+		"body":      body,
+	}
+	if !c.timestamp.IsZero() {
+		inComing["timestamp"] = c.timestamp.Format(time.RFC3339Nano)
+	}
+	detailLog.AddInputRequest("client", cmd, initInvoke, c.body, inComing, "kafka", c.topic)
 	c.detailLog = detailLog
 	c.summaryLog = summaryLog
 }
@@ -138,8 +230,23 @@ func (ctx *kafkaContext) SummaryLog() logger.SummaryLog {
 	return ctx.summaryLog
 }
 
+// ReadInput decodes the message value into data with the codec of the topic and runs its `validate` tags,
+// see Validate.
 func (ctx *kafkaContext) ReadInput(data any) error {
-	const errMsgFormat = "%s, payload: %s"
+	if err := ctx.decodeBody(data); err != nil {
+		return err
+	}
+	return Validate(data)
+}
+
+// decodeBody returns io.EOF for an empty value, e.g. a tombstone, like the
+// HTTP context does for an empty body.
+func (ctx *kafkaContext) decodeBody(data any) error {
+	const errMsgFormat = "%w, payload: %s"
+	codec := ctx.codec
+	if codec == nil {
+		codec = JSONCodec{}
+	}
 	val := reflect.ValueOf(data)
 	switch val.Kind() {
 	case reflect.Ptr, reflect.Interface:
@@ -147,30 +254,59 @@ func (ctx *kafkaContext) ReadInput(data any) error {
 			val.Elem().SetString(ctx.body)
 			return nil
 		}
+		if ctx.body == "" {
+			return io.EOF
+		}
 
-		if err := json.Unmarshal([]byte(ctx.body), data); err != nil {
-			return fmt.Errorf(errMsgFormat, err.Error(), ctx.body)
+		if err := codec.Decode(ctx.topic, []byte(ctx.body), data); err != nil {
+			return fmt.Errorf(errMsgFormat, err, ctx.body)
 		}
 		return nil
 	case reflect.String:
 		return fmt.Errorf("cannot assign to non-pointer string")
 	default:
-		err := json.Unmarshal([]byte(ctx.body), &data)
+		if ctx.body == "" {
+			return io.EOF
+		}
+		err := codec.Decode(ctx.topic, []byte(ctx.body), &data)
 		if err != nil {
-			return fmt.Errorf(errMsgFormat, err.Error(), ctx.body)
+			return fmt.Errorf(errMsgFormat, err, ctx.body)
 		}
 		return nil
 	}
 }
 
+// Response publishes data to the reply-to topic of a request, see Request.
+// For other messages it only ends the handler chain.
 func (ctx *kafkaContext) Response(code int, data any) error {
-	return nil
+	ctx.written = true
+	return ctx.reply(code, data)
+}
+
+func (ctx *kafkaContext) Request(topic string, payload any, timeout time.Duration) (*Reply, error) {
+	c, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx.Context(), "kafka-producer-"+topic)
+	defer span.End()
+
+	return request(c, ctx.options, topic, payload, timeout)
 }
 
 func (ctx *kafkaContext) SendMessage(topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error) {
-	c, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx.Context(), "kafka-consumer-"+topic)
+	c, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx.Context(), "kafka-producer-"+topic)
+	defer span.End()
+
+	return producer(c, ctx.producer, ctx.options.codec(topic), topic, payload, opts...)
+}
+
+func (ctx *kafkaContext) SendMessages(topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error) {
+	c, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx.Context(), "kafka-producer-"+topic)
+	defer span.End()
+
+	return sendMessages(c, ctx.producer, ctx.options.codec(topic), topic, payloads, opts...)
+}
+
+func (ctx *kafkaContext) SendMessageAsync(topic string, payload any, opts ...OptionProducerMsg) error {
+	c, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx.Context(), "kafka-producer-"+topic)
 	defer span.End()
 
-	ctx.ctx = c
-	return producer(ctx.producer, topic, payload, opts...)
+	return sendMessageAsync(c, ctx.async, ctx.options.codec(topic), topic, payload, opts...)
 }
@@ -1,9 +1,14 @@
 package kp
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
+	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/IBM/sarama/mocks"
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,3 +45,86 @@ func TestReadInput(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "hello world", input.Message)
 }
+
+type recordingDetailLog struct {
+	*MockDetailLog
+	protocol, protocolMethod string
+	data                     any
+}
+
+func (d *recordingDetailLog) AddInputRequest(node, cmd, invoke string, rawData, data any, protocol, protocolMethod string) {
+	d.data = data
+	d.protocol = protocol
+	d.protocolMethod = protocolMethod
+}
+
+type recordingLogger struct {
+	*MockLogger
+	initInvoke string
+	detailLog  *recordingDetailLog
+}
+
+func (l *recordingLogger) NewLog(ctx context.Context, initInvoke, scenario string) (logger.DetailLog, logger.SummaryLog) {
+	detailLog, summaryLog := l.MockLogger.NewLog(ctx, initInvoke, scenario)
+	l.initInvoke = initInvoke
+	l.detailLog = &recordingDetailLog{MockDetailLog: detailLog.(*MockDetailLog)}
+	return l.detailLog, summaryLog
+}
+
+func (l *recordingLogger) Session(v string) ILogger {
+	l.MockLogger.Session(v)
+	return l
+}
+
+func TestNewMessageContext(t *testing.T) {
+	timestamp := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	message := &sarama.ConsumerMessage{
+		Topic:     topic,
+		Key:       []byte("order-1"),
+		Value:     []byte(`{"id":"1"}`),
+		Partition: 2,
+		Offset:    42,
+		Timestamp: timestamp,
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte("X-Request-Id"), Value: []byte("req-1")},
+			{Key: []byte("source"), Value: []byte("billing")},
+		},
+	}
+	log := &recordingLogger{MockLogger: NewMockLogger()}
+
+	ctx := NewMessageContext(message, mocks.NewSyncProducer(t, nil), log)
+
+	assert.Equal(t, topic, ctx.Topic())
+	assert.Equal(t, "order-1", ctx.Key())
+	assert.Equal(t, int32(2), ctx.Partition())
+	assert.Equal(t, int64(42), ctx.Offset())
+	assert.Equal(t, timestamp, ctx.Timestamp())
+	assert.Equal(t, "billing", ctx.GetHeader("source"))
+	assert.Equal(t, "req-1", ctx.GetHeader(XRequestID))
+	assert.Len(t, ctx.Headers(), 2)
+
+	ctx.CommonLog("create_order", "order")
+
+	assert.Equal(t, "req-1", log.initInvoke)
+	assert.Equal(t, "kafka", log.detailLog.protocol)
+	assert.Equal(t, topic, log.detailLog.protocolMethod)
+	data := log.detailLog.data.(map[string]any)
+	assert.Equal(t, "order-1", data["key"])
+	assert.Equal(t, map[string]any{"id": "1"}, data["body"])
+}
+
+func TestBindTombstone(t *testing.T) {
+	type deleted struct {
+		ID string `json:"id"`
+	}
+
+	ctx := NewConsumerContext("books.deleted", "", nil, NewMockLogger())
+	req, err := Bind[deleted](ctx)
+	assert.NoError(t, err, "an empty value is an empty body")
+	assert.Empty(t, req.ID)
+
+	ctx = NewConsumerContext("books.deleted", "{", nil, NewMockLogger())
+	_, err = Bind[deleted](ctx)
+	var syntaxErr *json.SyntaxError
+	assert.ErrorAs(t, err, &syntaxErr, "the codec error is wrapped")
+}
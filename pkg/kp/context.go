@@ -7,8 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/sing3demons/go-library-api/pkg/kp/logger"
 	"go.opentelemetry.io/otel"
@@ -21,7 +22,9 @@ type IContext interface {
 	// Header() http.Header
 	// FullPath() string
 	// GetMethod() string
-	Next()
+
+	// Next runs the rest of the middleware chain and returns its error.
+	Next() error
 
 	Log() ILogger
 	Param(name string) string
@@ -30,6 +33,15 @@ type IContext interface {
 	Response(code int, data any) error
 
 	SendMessage(topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error)
+	// SendMessages publishes the payloads with one call of the batch API of
+	// the producer. The metadata are in the order of the payloads.
+	SendMessages(topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error)
+	// SendMessageAsync queues the payload on the async producer without waiting
+	// for the broker, see AsyncProducerConfig.
+	SendMessageAsync(topic string, payload any, opts ...OptionProducerMsg) error
+	// Request publishes payload to topic and waits up to timeout for the
+	// reply of its consumer, see KafkaConfig.ReplyTopic.
+	Request(topic string, payload any, timeout time.Duration) (*Reply, error)
 	CommonLog(cmd, scenario string)
 	DetailLog() logger.DetailLog
 	SummaryLog() logger.SummaryLog
@@ -41,8 +53,22 @@ type ServiceHandleFunc HandleFunc
 
 type Middleware func(HandleFunc) HandleFunc
 
+// routeContext is the framework specific part of an HTTP request. HttpContext
+// builds on it so every router backend behaves the same way for handlers.
+type routeContext interface {
+	Request() *http.Request
+	SetRequest(r *http.Request)
+	Param(name string) string
+	Params() map[string]string
+	Query(name string) string
+	GetHeader(key string) string
+	SetHeader(key, value string)
+	JSON(code int, data any) error
+	FullPath() string
+}
+
 type HttpContext struct {
-	ctx         *gin.Context
+	route       routeContext
 	cfg         *KafkaConfig
 	log         ILogger
 	detailLog   logger.DetailLog
@@ -50,30 +76,34 @@ type HttpContext struct {
 	baseCommand string
 	initInvoke  string
 	copyBody    []byte
+	status      int
+	written     bool
+	cause       error
 
-	// handlers []HandleFunc
-	// index    int
+	handlerChain
 }
 
-func newMuxContext(c *gin.Context, cfg *KafkaConfig, log ILogger) IContext {
-	ctx := InitSession(c.Request.Context(), log)
-	c.Request = c.Request.WithContext(ctx)
-	return &HttpContext{ctx: c, cfg: cfg, log: log}
+func newHttpContext(route routeContext, cfg *KafkaConfig, log ILogger) IContext {
+	r := route.Request()
+	ctx := InitSession(r.Context(), log)
+	route.SetRequest(r.WithContext(ctx))
+	return &HttpContext{route: route, cfg: cfg, log: log}
 }
 
 func (c *HttpContext) Incoming() logger.InComing {
 	var data logger.InComing
+	r := c.route.Request()
 
 	// check method if GET or DELETE not request body
-	if c.ctx.Request.Method == "GET" || c.ctx.Request.Method == "DELETE" {
+	if r.Method == "GET" || r.Method == "DELETE" {
 		c.copyBody = nil
 	} else {
 		// --- Copy and parse body ---
 		var body map[string]any
-		rawBody, err := io.ReadAll(c.ctx.Request.Body)
+		rawBody, err := io.ReadAll(r.Body)
 		if err == nil && len(rawBody) > 0 {
 			// Restore body stream for future reads
-			c.ctx.Request.Body = io.NopCloser(bytes.NewBuffer(rawBody))
+			r.Body = io.NopCloser(bytes.NewBuffer(rawBody))
 
 			// Try parsing JSON
 			if err := json.Unmarshal(rawBody, &body); err == nil && len(body) > 0 {
@@ -83,7 +113,7 @@ func (c *HttpContext) Incoming() logger.InComing {
 	}
 
 	// --- Copy headers ---
-	if headers := c.ctx.Request.Header; len(headers) > 0 {
+	if headers := r.Header; len(headers) > 0 {
 		headerMap := make(map[string]any, len(headers))
 		for key, values := range headers {
 			if len(values) > 0 {
@@ -94,22 +124,22 @@ func (c *HttpContext) Incoming() logger.InComing {
 	}
 
 	// --- Copy query string ---
-	if query := c.ctx.Request.URL.Query(); len(query) > 0 {
+	if query := r.URL.Query(); len(query) > 0 {
 		data.QueryString = query
 	}
 
 	// --- Copy path parameters ---
-	if params := c.ctx.Params; len(params) > 0 {
+	if params := c.route.Params(); len(params) > 0 {
 		paramMap := make(map[string]any, len(params))
-		for _, param := range params {
-			if param.Key != "" && param.Value != "" {
-				paramMap[param.Key] = param.Value
+		for key, value := range params {
+			if key != "" && value != "" {
+				paramMap[key] = value
 			}
 		}
 		data.PathParams = paramMap
 	}
 	// --- Copy cookies ---
-	if cookies := c.ctx.Request.Cookies(); len(cookies) > 0 {
+	if cookies := r.Cookies(); len(cookies) > 0 {
 		cookieMap := make(map[string]any, len(cookies))
 		for _, cookie := range cookies {
 			if cookie.Name != "" && cookie.Value != "" {
@@ -125,20 +155,16 @@ func (c *HttpContext) Incoming() logger.InComing {
 func (c *HttpContext) CommonLog(cmd, scenario string) {
 	inComing := c.Incoming()
 
-	xrid := inComing.Header["x-request-id"]
-	var initInvoke string
-	if xrid != nil {
-		initInvoke = xrid.(string)
-	}
-
+	initInvoke := c.GetHeader(XRequestID)
 	if initInvoke == "" {
 		initInvoke = GenerateXTid("clnt")
 	}
 
-	detailLog, summaryLog := c.Log().NewLog(c.ctx.Request.Context(), initInvoke, scenario)
+	r := c.route.Request()
+	detailLog, summaryLog := c.Log().NewLog(r.Context(), initInvoke, scenario)
 
-	protocol := c.ctx.Request.Proto
-	protocolMethod := c.ctx.Request.Method
+	protocol := r.Proto
+	protocolMethod := r.Method
 	detailLog.AddInputHttpRequest("client", cmd, initInvoke, inComing, true, protocol, protocolMethod)
 	c.baseCommand = cmd
 	c.initInvoke = initInvoke
@@ -155,12 +181,11 @@ func (c *HttpContext) SummaryLog() logger.SummaryLog {
 }
 
 func (c *HttpContext) Context() context.Context {
-	return c.ctx.Request.Context()
+	return c.route.Request().Context()
 }
 
 func (c *HttpContext) SendMessage(topic string, message any, opts ...OptionProducerMsg) (RecordMetadata, error) {
 	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c.Context(), "kafka-producer-"+topic)
-	c.ctx.Request = c.ctx.Request.WithContext(ctx)
 	defer span.End()
 	invoke := uuid.NewString()
 	c.detailLog.AddOutputRequest("kafka", "producer", invoke, message, map[string]any{
@@ -169,7 +194,7 @@ func (c *HttpContext) SendMessage(topic string, message any, opts ...OptionProdu
 			"value": message,
 		},
 	}, "kafka", "")
-	result, err := producer(c.cfg.producer, topic, message, opts...)
+	result, err := producer(ctx, c.cfg.producer, c.cfg.codec(topic), topic, message, opts...)
 	if err != nil {
 		c.detailLog.AddInputResponse("kafka", "producer", invoke, message, err.Error())
 		c.summaryLog.AddError("kafka", "producer", "", err.Error())
@@ -180,6 +205,69 @@ func (c *HttpContext) SendMessage(topic string, message any, opts ...OptionProdu
 	return result, nil
 }
 
+func (c *HttpContext) SendMessages(topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c.Context(), "kafka-producer-"+topic)
+	defer span.End()
+	invoke := uuid.NewString()
+	c.detailLog.AddOutputRequest("kafka", "producer", invoke, payloads, map[string]any{
+		"Body": map[string]any{
+			"topic": topic,
+			"value": payloads,
+		},
+	}, "kafka", "")
+	result, err := sendMessages(ctx, c.cfg.producer, c.cfg.codec(topic), topic, payloads, opts...)
+	if err != nil {
+		c.detailLog.AddInputResponse("kafka", "producer", invoke, payloads, err.Error())
+		c.summaryLog.AddError("kafka", "producer", "", err.Error())
+		return result, err
+	}
+	c.detailLog.AddInputResponse("kafka", "producer", invoke, result, result)
+	c.summaryLog.AddSuccess("kafka", "producer", "20000", "success")
+	return result, nil
+}
+
+func (c *HttpContext) SendMessageAsync(topic string, payload any, opts ...OptionProducerMsg) error {
+	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c.Context(), "kafka-producer-"+topic)
+	defer span.End()
+	invoke := uuid.NewString()
+	c.detailLog.AddOutputRequest("kafka", "producer", invoke, payload, map[string]any{
+		"Body": map[string]any{
+			"topic": topic,
+			"value": payload,
+		},
+	}, "kafka", "")
+	if err := sendMessageAsync(ctx, c.cfg.async, c.cfg.codec(topic), topic, payload, opts...); err != nil {
+		c.detailLog.AddInputResponse("kafka", "producer", invoke, payload, err.Error())
+		c.summaryLog.AddError("kafka", "producer", "", err.Error())
+		return err
+	}
+	queued := map[string]any{"queued": true}
+	c.detailLog.AddInputResponse("kafka", "producer", invoke, queued, queued)
+	c.summaryLog.AddSuccess("kafka", "producer", "20000", "queued")
+	return nil
+}
+
+func (c *HttpContext) Request(topic string, payload any, timeout time.Duration) (*Reply, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c.Context(), "kafka-producer-"+topic)
+	defer span.End()
+	invoke := uuid.NewString()
+	c.detailLog.AddOutputRequest("kafka", "request", invoke, payload, map[string]any{
+		"Body": map[string]any{
+			"topic": topic,
+			"value": payload,
+		},
+	}, "kafka", "")
+	reply, err := request(ctx, c.cfg, topic, payload, timeout)
+	if err != nil {
+		c.detailLog.AddInputResponse("kafka", "request", invoke, payload, err.Error())
+		c.summaryLog.AddError("kafka", "request", "", err.Error())
+		return nil, err
+	}
+	c.detailLog.AddInputResponse("kafka", "request", invoke, string(reply.Body), reply.Body)
+	c.summaryLog.AddSuccess("kafka", "request", strconv.Itoa(reply.Code), "success")
+	return reply, nil
+}
+
 func (c *HttpContext) Log() ILogger {
 	switch logger := c.Context().Value(key).(type) {
 	case ILogger:
@@ -190,27 +278,34 @@ func (c *HttpContext) Log() ILogger {
 }
 
 func (c *HttpContext) Query(name string) string {
-	return c.ctx.Query(name)
+	return c.route.Query(name)
 }
 
 func (c *HttpContext) Param(name string) string {
-	return c.ctx.Param(name)
+	return c.route.Param(name)
 }
 
+// ReadInput decodes the JSON body into data and runs its `validate` tags,
+// see Validate.
 func (c *HttpContext) ReadInput(data any) error {
+	if err := c.decodeBody(data); err != nil {
+		return err
+	}
+	return Validate(data)
+}
+
+func (c *HttpContext) decodeBody(data any) error {
 	// Read the body into a byte slice
-	err := json.NewDecoder(c.ctx.Request.Body).Decode(data)
+	err := json.NewDecoder(c.route.Request().Body).Decode(data)
 	if err != nil {
-		if c.copyBody != nil {
-			if nErr := json.Unmarshal(c.copyBody, data); nErr != nil {
-				return nErr
-			}
-			c.copyBody = nil
-			return nil
+		if c.copyBody == nil {
+			return err
 		}
-		return err
+		if nErr := json.Unmarshal(c.copyBody, data); nErr != nil {
+			return nErr
+		}
+		c.copyBody = nil
 	}
-
 	return nil
 }
 
@@ -218,10 +313,20 @@ func (c *HttpContext) Response(responseCode int, responseData any) error {
 	// c.w.Header().Set("Content-type", "application/json; charset=UTF8")
 	// c.w.WriteHeader(responseCode)
 	// return json.NewEncoder(c.w).Encode(responseData)
-	c.ctx.JSON(responseCode, responseData)
-	c.detailLog.AddOutputResponse("client", c.baseCommand, c.initInvoke, responseData, responseData)
+	c.status = responseCode
+	c.written = true
+	if err := c.route.JSON(responseCode, responseData); err != nil {
+		return err
+	}
+	if c.detailLog != nil {
+		data := responseData
+		if c.cause != nil {
+			data = map[string]any{"response": responseData, "error": c.cause.Error()}
+		}
+		c.detailLog.AddOutputResponse("client", c.baseCommand, c.initInvoke, responseData, data)
+	}
 
-	if !c.summaryLog.IsEnd() {
+	if c.summaryLog != nil && !c.summaryLog.IsEnd() {
 		c.summaryLog.End(fmt.Sprintf("%d", responseCode), "")
 	}
 	c = nil
@@ -230,27 +335,48 @@ func (c *HttpContext) Response(responseCode int, responseData any) error {
 }
 
 func (c *HttpContext) SetHeader(key, value string) {
-	c.ctx.Header(key, value)
+	c.route.SetHeader(key, value)
 }
 
 func (c *HttpContext) GetHeader(key string) string {
-	return c.ctx.GetHeader(key)
+	return c.route.GetHeader(key)
 }
 
-func (c *HttpContext) Next() {
-	c.ctx.Next()
+func (c *HttpContext) Next() error {
+	return c.run(c)
+}
+
+func (c *HttpContext) command() string {
+	return c.baseCommand
+}
+
+func (c *HttpContext) fail(err error) {
+	c.cause = err
+}
+
+// Written reports whether a response has already been sent.
+func (c *HttpContext) Written() bool {
+	return c.written
+}
+
+// Status returns the status code of the response, http.StatusOK if none was sent.
+func (c *HttpContext) Status() int {
+	if c.status == 0 {
+		return http.StatusOK
+	}
+	return c.status
 }
 
 func (c *HttpContext) Header() http.Header {
-	return c.ctx.Request.Header
+	return c.route.Request().Header
 }
 
 func (c *HttpContext) FullPath() string {
-	return c.ctx.FullPath()
+	return c.route.FullPath()
 }
 func (c *HttpContext) GetMethod() string {
-	return c.ctx.Request.Method
+	return c.route.Request().Method
 }
 func (c *HttpContext) GetPath() string {
-	return c.ctx.Request.URL.Path
+	return c.route.Request().URL.Path
 }
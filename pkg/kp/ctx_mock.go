@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/sing3demons/go-library-api/pkg/kp/logger"
 )
@@ -159,6 +160,21 @@ func (m *MockContext) SendMessage(topic string, payload any, opts ...OptionProdu
 	return RecordMetadata{}, nil
 }
 
+func (m *MockContext) SendMessages(topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error) {
+	m.methodsToCall["SendMessages"] = true
+	return make([]RecordMetadata, len(payloads)), nil
+}
+
+func (m *MockContext) SendMessageAsync(topic string, payload any, opts ...OptionProducerMsg) error {
+	m.methodsToCall["SendMessageAsync"] = true
+	return nil
+}
+
+func (m *MockContext) Request(topic string, payload any, timeout time.Duration) (*Reply, error) {
+	m.methodsToCall["Request"] = true
+	return &Reply{Code: 200, codec: JSONCodec{}}, nil
+}
+
 func (m *MockContext) Context() context.Context {
 	m.methodsToCall["Context"] = true
 	return m.Ctx
@@ -174,8 +190,9 @@ func (m *MockContext) GetHeader(key string) string {
 	return m.Headers[key]
 }
 
-func (m *MockContext) Next() {
+func (m *MockContext) Next() error {
 	m.methodsToCall["Next"] = true
+	return nil
 }
 
 func (m *MockContext) Log() ILogger {
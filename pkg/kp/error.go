@@ -0,0 +1,149 @@
+package kp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is an application error that knows how it is reported: the HTTP
+// status of the response and the result code of the summary log.
+type Error struct {
+	Code       string
+	Status     int
+	ResultCode string
+	Message    string
+	Details    any
+	Cause      error
+}
+
+func NewError(status int, code, resultCode, message string) *Error {
+	return &Error{
+		Code:       code,
+		Status:     status,
+		ResultCode: resultCode,
+		Message:    message,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// WithCause returns a copy of e that wraps cause.
+func (e *Error) WithCause(cause error) *Error {
+	err := *e
+	err.Cause = cause
+	return &err
+}
+
+func BadRequest(message string) *Error {
+	return NewError(http.StatusBadRequest, "BAD_REQUEST", "40000", message)
+}
+
+func Unauthorized(message string) *Error {
+	return NewError(http.StatusUnauthorized, "UNAUTHORIZED", "40100", message)
+}
+
+func NotFound(message string) *Error {
+	return NewError(http.StatusNotFound, "NOT_FOUND", "40400", message)
+}
+
+func Conflict(message string) *Error {
+	return NewError(http.StatusConflict, "CONFLICT", "40900", message)
+}
+
+// Internal wraps an unexpected error. The cause is logged but not sent to the client.
+func Internal(cause error) *Error {
+	return NewError(http.StatusInternalServerError, "INTERNAL", "50000", "internal server error").WithCause(cause)
+}
+
+// AsError returns the *Error in err's chain, or wraps err as Internal. A
+// *ValidationError becomes a BadRequest that lists the failing fields.
+func AsError(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return InvalidInput(err)
+	}
+	return Internal(err)
+}
+
+// InvalidInput maps an error of IContext.ReadInput to a BadRequest. Validation
+// errors keep the list of failing fields as the error details.
+func InvalidInput(err error) *Error {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		e := BadRequest("validation failed").WithCause(err)
+		e.Details = ve.Fields
+		return e
+	}
+	return BadRequest("invalid request").WithCause(err)
+}
+
+// ErrorHandler reports an error returned by the handler chain.
+type ErrorHandler func(ctx IContext, err error)
+
+// failedContext is a context that records why its handler failed.
+type failedContext interface {
+	// command is the command of CommonLog.
+	command() string
+	// fail keeps err for the detail log entry of the error response.
+	fail(err error)
+}
+
+// DefaultErrorHandler closes the summary log with the result code of the
+// error and, unless the handler already responded, writes a JSON error body.
+// The response is recorded in the detail log by IContext.Response, with the
+// error and its cause, which the client does not see.
+func DefaultErrorHandler(ctx IContext, err error) {
+	e := AsError(err)
+	if e.Status >= http.StatusInternalServerError {
+		ctx.Log().Errorf("handler error: %v", err)
+	}
+
+	var cmd string
+	if fc, ok := ctx.(failedContext); ok {
+		cmd = fc.command()
+		fc.fail(err)
+	}
+
+	if summaryLog := ctx.SummaryLog(); summaryLog != nil && !summaryLog.IsEnd() {
+		summaryLog.AddError("client", cmd, e.ResultCode, e.Message)
+		summaryLog.End(e.ResultCode, e.Message)
+	}
+
+	if w, ok := ctx.(interface{ Written() bool }); ok && w.Written() {
+		return
+	}
+
+	body := map[string]any{
+		"code":  e.Code,
+		"error": e.Message,
+	}
+	if e.Details != nil {
+		body["details"] = e.Details
+	}
+	ctx.Response(e.Status, body)
+}
+
+func handleError(handler ErrorHandler, ctx IContext, err error) {
+	if err == nil {
+		return
+	}
+	if handler == nil {
+		handler = DefaultErrorHandler
+	}
+	handler(ctx, err)
+}
@@ -0,0 +1,177 @@
+package kp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsError(t *testing.T) {
+	cause := errors.New("duplicate key")
+	err := fmt.Errorf("save user: %w", Conflict("user exists").WithCause(cause))
+
+	e := AsError(err)
+	assert.Equal(t, http.StatusConflict, e.Status)
+	assert.Equal(t, "40900", e.ResultCode)
+	assert.ErrorIs(t, err, cause)
+
+	e = AsError(errors.New("boom"))
+	assert.Equal(t, http.StatusInternalServerError, e.Status)
+	assert.Equal(t, "INTERNAL", e.Code)
+	assert.Equal(t, "internal server error", e.Message)
+}
+
+func TestErrorConstructors(t *testing.T) {
+	cases := map[int]*Error{
+		http.StatusBadRequest:          BadRequest("bad"),
+		http.StatusUnauthorized:        Unauthorized("who"),
+		http.StatusNotFound:            NotFound("missing"),
+		http.StatusConflict:            Conflict("exists"),
+		http.StatusInternalServerError: Internal(errors.New("boom")),
+	}
+	for status, e := range cases {
+		assert.Equal(t, status, e.Status)
+		assert.Equal(t, fmt.Sprintf("%d00", status), e.ResultCode)
+	}
+}
+
+func TestRouterBackendsErrorHandler(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			app.Get("/books/:id", func(ctx IContext) error {
+				ctx.CommonLog("get_book", "book")
+				return NotFound("book not found")
+			})
+			app.Get("/boom", func(ctx IContext) error {
+				return errors.New("database down")
+			})
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books/1", nil))
+
+			var body map[string]any
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.Equal(t, "NOT_FOUND", body["code"])
+			assert.Equal(t, "book not found", body["error"])
+
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/boom", nil))
+
+			body = nil
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.Equal(t, "internal server error", body["error"])
+		})
+	}
+}
+
+func TestErrorHandlerKeepsWrittenResponse(t *testing.T) {
+	app := newBackendApplication(Mux)
+
+	app.Post("/test", func(ctx IContext) error {
+		ctx.Response(http.StatusAccepted, map[string]any{"status": "queued"})
+		return errors.New("publish failed")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/test", nil))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.JSONEq(t, `{"status":"queued"}`, rec.Body.String())
+}
+
+func TestSetErrorHandler(t *testing.T) {
+	app := newBackendApplication(Gin)
+
+	var got error
+	app.SetErrorHandler(func(ctx IContext, err error) {
+		got = err
+		ctx.Response(http.StatusTeapot, map[string]any{"custom": true})
+	})
+	app.Get("/test", func(ctx IContext) error {
+		return Unauthorized("token expired")
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Equal(t, http.StatusUnauthorized, AsError(got).Status)
+}
+
+type errorDetailLog struct {
+	*MockDetailLog
+	responses []any
+}
+
+func (l *errorDetailLog) AddOutputResponse(node, cmd, invoke string, rawData, data any) {
+	l.responses = append(l.responses, data)
+}
+
+type errorSummaryLog struct {
+	*MockSummaryLog
+	errorCmds []string
+	ended     bool
+}
+
+func (l *errorSummaryLog) IsEnd() bool {
+	return l.ended
+}
+
+func (l *errorSummaryLog) End(resultCode, resultDescription string) error {
+	l.ended = true
+	return nil
+}
+
+func (l *errorSummaryLog) AddError(node, cmd, code, desc string) {
+	l.errorCmds = append(l.errorCmds, cmd)
+}
+
+type errorRecordingLogger struct {
+	*MockLogger
+	detailLog  *errorDetailLog
+	summaryLog *errorSummaryLog
+}
+
+func (l *errorRecordingLogger) NewLog(ctx context.Context, initInvoke, scenario string) (logger.DetailLog, logger.SummaryLog) {
+	detailLog, summaryLog := l.MockLogger.NewLog(ctx, initInvoke, scenario)
+	l.detailLog = &errorDetailLog{MockDetailLog: detailLog.(*MockDetailLog)}
+	l.summaryLog = &errorSummaryLog{MockSummaryLog: summaryLog.(*MockSummaryLog)}
+	return l.detailLog, l.summaryLog
+}
+
+func (l *errorRecordingLogger) Session(v string) ILogger {
+	l.MockLogger.Session(v)
+	return l
+}
+
+func TestDefaultErrorHandlerLogs(t *testing.T) {
+	log := &errorRecordingLogger{MockLogger: NewMockLogger()}
+	app := NewApplication(&Config{AppConfig: AppConfig{Port: "8888", Router: Gin}}, log)
+	app.Get("/books/:id", func(ctx IContext) error {
+		ctx.CommonLog("get_book", "book")
+		return NotFound("book not found").WithCause(errors.New("no rows in result set"))
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books/1", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "no rows")
+	assert.Equal(t, []string{"get_book"}, log.summaryLog.errorCmds)
+	if assert.Len(t, log.detailLog.responses, 1) {
+		data := log.detailLog.responses[0].(map[string]any)
+		assert.Equal(t, "NOT_FOUND: book not found: no rows in result set", data["error"])
+		assert.Equal(t, map[string]any{"code": "NOT_FOUND", "error": "book not found"}, data["response"])
+	}
+}
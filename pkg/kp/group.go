@@ -0,0 +1,91 @@
+package kp
+
+import "strings"
+
+type IRouterGroup interface {
+	Get(path string, handler HandleFunc, middlewares ...Middleware)
+	Post(path string, handler HandleFunc, middlewares ...Middleware)
+	Put(path string, handler HandleFunc, middlewares ...Middleware)
+	Delete(path string, handler HandleFunc, middlewares ...Middleware)
+	Patch(path string, handler HandleFunc, middlewares ...Middleware)
+
+	Use(middlewares ...Middleware)
+	Group(prefix string, middlewares ...Middleware) IRouterGroup
+}
+
+// routes is the part of IRouter a group registers its handlers on.
+type routes interface {
+	Get(path string, handler HandleFunc, middlewares ...Middleware)
+	Post(path string, handler HandleFunc, middlewares ...Middleware)
+	Put(path string, handler HandleFunc, middlewares ...Middleware)
+	Delete(path string, handler HandleFunc, middlewares ...Middleware)
+	Patch(path string, handler HandleFunc, middlewares ...Middleware)
+}
+
+// routerGroup mounts routes under a prefix on its parent. The group middlewares
+// run after the parent's middlewares and before the route's own middlewares.
+type routerGroup struct {
+	parent      routes
+	prefix      string
+	middlewares []Middleware
+}
+
+func newRouterGroup(parent routes, prefix string, middlewares ...Middleware) IRouterGroup {
+	return &routerGroup{
+		parent:      parent,
+		prefix:      prefix,
+		middlewares: middlewares,
+	}
+}
+
+// chain resolves the group middlewares per request, so Use also applies to
+// routes registered before it was called, the same way IApplication.Use does.
+func (g *routerGroup) chain(next HandleFunc) HandleFunc {
+	return func(ctx IContext) error {
+		return preHandle(next, g.middlewares...)(ctx)
+	}
+}
+
+func (g *routerGroup) route(middlewares []Middleware) []Middleware {
+	return preMiddleware([]Middleware{g.chain}, middlewares)
+}
+
+func (g *routerGroup) Get(path string, handler HandleFunc, middlewares ...Middleware) {
+	g.parent.Get(joinPath(g.prefix, path), handler, g.route(middlewares)...)
+}
+
+func (g *routerGroup) Post(path string, handler HandleFunc, middlewares ...Middleware) {
+	g.parent.Post(joinPath(g.prefix, path), handler, g.route(middlewares)...)
+}
+
+func (g *routerGroup) Put(path string, handler HandleFunc, middlewares ...Middleware) {
+	g.parent.Put(joinPath(g.prefix, path), handler, g.route(middlewares)...)
+}
+
+func (g *routerGroup) Delete(path string, handler HandleFunc, middlewares ...Middleware) {
+	g.parent.Delete(joinPath(g.prefix, path), handler, g.route(middlewares)...)
+}
+
+func (g *routerGroup) Patch(path string, handler HandleFunc, middlewares ...Middleware) {
+	g.parent.Patch(joinPath(g.prefix, path), handler, g.route(middlewares)...)
+}
+
+func (g *routerGroup) Use(middlewares ...Middleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+func (g *routerGroup) Group(prefix string, middlewares ...Middleware) IRouterGroup {
+	return newRouterGroup(g, prefix, middlewares...)
+}
+
+// joinPath appends path to prefix with exactly one slash between them.
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if path == "" || path == "/" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	return prefix + "/" + strings.TrimLeft(path, "/")
+}
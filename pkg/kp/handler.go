@@ -0,0 +1,148 @@
+package kp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+)
+
+// JSON adapts a typed function to a HandleFunc. The adapter calls CommonLog,
+// binds the request into Req, validates it, calls fn and responds with
+// http.StatusOK and the result. Errors go to the error handler of the server.
+//
+// Req is bound from the body (or the Kafka message value) first, then from
+// the `param:"name"` and `query:"name"` tags of its fields:
+//
+//	type GetBookRequest struct {
+//		ID string `param:"id" validate:"required,uuid"`
+//	}
+func JSON[Req, Res any](cmd, scenario string, fn func(ctx IContext, req Req) (Res, error)) HandleFunc {
+	return Handle(http.StatusOK, cmd, scenario, fn)
+}
+
+// Created is JSON responding with http.StatusCreated.
+func Created[Req, Res any](cmd, scenario string, fn func(ctx IContext, req Req) (Res, error)) HandleFunc {
+	return Handle(http.StatusCreated, cmd, scenario, fn)
+}
+
+// Message adapts a typed function to a consumer handler. The message value is
+// decoded and validated into Req before fn is called.
+func Message[Req any](cmd, scenario string, fn func(ctx IContext, req Req) error) ServiceHandleFunc {
+	return func(ctx IContext) error {
+		ctx.CommonLog(cmd, scenario)
+
+		req, err := Bind[Req](ctx)
+		if err != nil {
+			return InvalidInput(err)
+		}
+		return fn(ctx, req)
+	}
+}
+
+// Handle adapts a typed function to a HandleFunc that responds with status,
+// see JSON.
+func Handle[Req, Res any](status int, cmd, scenario string, fn func(ctx IContext, req Req) (Res, error)) HandleFunc {
+	return func(ctx IContext) error {
+		ctx.CommonLog(cmd, scenario)
+
+		req, err := Bind[Req](ctx)
+		if err != nil {
+			return InvalidInput(err)
+		}
+
+		res, err := fn(ctx, req)
+		if err != nil {
+			return err
+		}
+		return ctx.Response(status, res)
+	}
+}
+
+// Bind decodes the body, path params and query of ctx into a new T and
+// validates it. An empty body is not an error.
+func Bind[T any](ctx IContext) (T, error) {
+	var req T
+
+	if d, ok := ctx.(interface{ decodeBody(data any) error }); ok {
+		if err := d.decodeBody(&req); err != nil && !errors.Is(err, io.EOF) {
+			return req, err
+		}
+	} else if err := ctx.ReadInput(&req); err != nil && !errors.Is(err, io.EOF) {
+		return req, err
+	}
+
+	if err := bindValues(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, Validate(&req)
+}
+
+// bindValues fills the fields of a struct tagged with `param` or `query`.
+func bindValues(ctx IContext, data any) error {
+	v := reflect.ValueOf(data).Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		var value string
+		if name := field.Tag.Get("param"); name != "" {
+			value = ctx.Param(name)
+		}
+		if name := field.Tag.Get("query"); name != "" && value == "" {
+			value = ctx.Query(name)
+		}
+		if value == "" {
+			continue
+		}
+
+		if err := setValue(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
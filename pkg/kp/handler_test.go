@@ -0,0 +1,105 @@
+package kp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+type updateBookRequest struct {
+	ID      string `param:"id" validate:"required"`
+	Version int    `query:"version"`
+	Title   string `json:"title" validate:"required"`
+}
+
+type updateBookResponse struct {
+	ID      string `json:"id"`
+	Version int    `json:"version"`
+	Title   string `json:"title"`
+}
+
+func updateBook(ctx IContext, req updateBookRequest) (updateBookResponse, error) {
+	if req.ID == "missing" {
+		return updateBookResponse{}, NotFound("book not found")
+	}
+	return updateBookResponse(req), nil
+}
+
+func TestRouterBackendsJSONHandler(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+			app.Put("/books/:id", JSON("update_book", "book", updateBook))
+
+			body, _ := json.Marshal(map[string]any{"title": "Go"})
+			req := httptest.NewRequest(http.MethodPut, "/books/42?version=3", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, printErr(http.StatusOK, rec.Code))
+			var res updateBookResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+			assert.Equal(t, updateBookResponse{ID: "42", Version: 3, Title: "Go"}, res)
+		})
+	}
+}
+
+func TestJSONHandlerErrors(t *testing.T) {
+	app := newBackendApplication(Gin)
+	app.Put("/books/:id", JSON("update_book", "book", updateBook))
+
+	tests := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "validation", path: "/books/42", body: `{}`, status: http.StatusBadRequest},
+		{name: "malformed query", path: "/books/42?version=x", body: `{"title":"Go"}`, status: http.StatusBadRequest},
+		{name: "handler error", path: "/books/missing", body: `{"title":"Go"}`, status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.path, bytes.NewBufferString(tt.body))
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, tt.status, rec.Code, printErr(tt.status, rec.Code))
+		})
+	}
+}
+
+func TestCreatedHandlerWithoutBody(t *testing.T) {
+	app := newBackendApplication(Gin)
+	app.Post("/books", Created("create_book", "book", func(ctx IContext, _ struct{}) (map[string]string, error) {
+		return map[string]string{"status": "ok"}, nil
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/books", nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code, printErr(http.StatusCreated, rec.Code))
+}
+
+func TestMessageHandler(t *testing.T) {
+	var got validateInput
+	handler := Message("create_user", "user", func(ctx IContext, req validateInput) error {
+		got = req
+		return nil
+	})
+
+	ctx := NewConsumerContext(topic, `{"name":"bob","email":"bob@example.com","status":"active"}`, mocks.NewSyncProducer(t, nil), NewMockLogger())
+	assert.NoError(t, handler(ctx))
+	assert.Equal(t, "bob", got.Name)
+
+	ctx = NewConsumerContext(topic, `{"name":"bob","email":"invalid"}`, mocks.NewSyncProducer(t, nil), NewMockLogger())
+	err := handler(ctx)
+	assert.Equal(t, http.StatusBadRequest, AsError(err).Status)
+}
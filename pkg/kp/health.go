@@ -0,0 +1,193 @@
+package kp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+const (
+	HealthUp   = "UP"
+	HealthDown = "DOWN"
+
+	healthLivePath  = "/health/live"
+	healthReadyPath = "/health/ready"
+)
+
+// healthCheckTimeout bounds every readiness check, a probe must not hang on a
+// dependency that does not answer.
+var healthCheckTimeout = 2 * time.Second
+
+// HealthChecker reports whether a dependency of the service is reachable.
+type HealthChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HealthCheckFunc adapts a function to a HealthChecker.
+type HealthCheckFunc func(ctx context.Context) error
+
+func (f HealthCheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// PingChecker checks a database/sql connection pool, e.g. postgres.DB.
+func PingChecker(db interface {
+	PingContext(ctx context.Context) error
+}) HealthChecker {
+	return HealthCheckFunc(db.PingContext)
+}
+
+// MongoChecker pings the primary of a mongo client, e.g. mongo.Client.
+func MongoChecker(client interface {
+	Ping(ctx context.Context, rp *readpref.ReadPref) error
+}) HealthChecker {
+	return HealthCheckFunc(func(ctx context.Context) error {
+		return client.Ping(ctx, readpref.Primary())
+	})
+}
+
+// HealthResult is the outcome of one checker.
+type HealthResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthReport is the body of the health endpoints.
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks,omitempty"`
+}
+
+type health struct {
+	mu           sync.RWMutex
+	names        []string
+	checkers     map[string]HealthChecker
+	shuttingDown atomic.Bool
+}
+
+func newHealth() *health {
+	return &health{checkers: make(map[string]HealthChecker)}
+}
+
+func (h *health) add(name string, checker HealthChecker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, exists := h.checkers[name]; !exists {
+		h.names = append(h.names, name)
+	}
+	h.checkers[name] = checker
+}
+
+// check runs every checker concurrently.
+func (h *health) check(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	names := append([]string(nil), h.names...)
+	checkers := make(map[string]HealthChecker, len(h.checkers))
+	for name, checker := range h.checkers {
+		checkers[name] = checker
+	}
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: HealthUp, Checks: make(map[string]HealthResult, len(names))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string, checker HealthChecker) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := checker.Check(ctx)
+			result := HealthResult{Status: HealthUp, Latency: time.Since(start).String()}
+			if err != nil {
+				result.Status = HealthDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = HealthDown
+			}
+			mu.Unlock()
+		}(name, checkers[name])
+	}
+	wg.Wait()
+
+	if h.shuttingDown.Load() {
+		report.Status = HealthDown
+	}
+	return report
+}
+
+// handler serves the probes in front of the router, outside its middlewares:
+// an auth or log middleware must not answer or slow down the kubelet.
+func (h *health) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.URL.Path {
+		case healthLivePath:
+			writeHealth(w, http.StatusOK, HealthReport{Status: HealthUp})
+		case healthReadyPath:
+			report := h.check(r.Context())
+			if report.Status != HealthUp {
+				writeHealth(w, http.StatusServiceUnavailable, report)
+				return
+			}
+			writeHealth(w, http.StatusOK, report)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func writeHealth(w http.ResponseWriter, code int, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Check reports whether the brokers answer a metadata request of the admin
+// client, with the TLS and SASL settings of the producer and the consumer,
+// and the consumer group has not stopped with an error.
+func (s *KafkaServer) Check(ctx context.Context) error {
+	if err := s.consumerError(); err != nil {
+		return err
+	}
+
+	// sarama takes no context, the probe returns on ctx and leaves the
+	// request to finish in the background
+	done := make(chan error, 1)
+	go func() {
+		admin, err := s.admin()
+		if err != nil {
+			done <- err
+			return
+		}
+		if p, ok := admin.(interface{ ping() error }); ok {
+			err = p.ping()
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
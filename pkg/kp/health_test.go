@@ -0,0 +1,125 @@
+package kp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHealth(app IApplication, path string) (int, HealthReport) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	var report HealthReport
+	json.Unmarshal(rec.Body.Bytes(), &report)
+	return rec.Code, report
+}
+
+func TestRouterBackendsHealthLive(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			code, report := getHealth(app, "/health/live")
+
+			assert.Equal(t, http.StatusOK, code, printErr(http.StatusOK, code))
+			assert.Equal(t, HealthUp, report.Status)
+		})
+	}
+}
+
+func TestHealthSkipsMiddlewares(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+			app.Use(func(next HandleFunc) HandleFunc {
+				return func(ctx IContext) error {
+					return Unauthorized("missing token")
+				}
+			})
+
+			code, _ := getHealth(app, "/health/live")
+			assert.Equal(t, http.StatusOK, code, printErr(http.StatusOK, code))
+			code, _ = getHealth(app, "/health/ready")
+			assert.Equal(t, http.StatusOK, code, printErr(http.StatusOK, code))
+		})
+	}
+}
+
+func TestHealthReady(t *testing.T) {
+	app := newBackendApplication(Gin)
+	app.AddHealthCheck("postgres", HealthCheckFunc(func(ctx context.Context) error { return nil }))
+
+	code, report := getHealth(app, "/health/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, HealthUp, report.Status)
+	assert.Equal(t, HealthUp, report.Checks["postgres"].Status)
+	assert.NotEmpty(t, report.Checks["postgres"].Latency)
+
+	app.AddHealthCheck("mongo", HealthCheckFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+
+	code, report = getHealth(app, "/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthDown, report.Status)
+	assert.Equal(t, HealthUp, report.Checks["postgres"].Status)
+	assert.Equal(t, HealthDown, report.Checks["mongo"].Status)
+	assert.Equal(t, "connection refused", report.Checks["mongo"].Error)
+}
+
+func TestHealthReadyDuringShutdown(t *testing.T) {
+	app := newBackendApplication(Gin)
+	app.(*Server).health.shuttingDown.Store(true)
+
+	code, report := getHealth(app, "/health/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, HealthDown, report.Status)
+
+	code, _ = getHealth(app, "/health/live")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestKafkaServerCheck(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()),
+	})
+
+	server := &KafkaServer{options: &KafkaConfig{Brokers: []string{broker.Addr()}, GroupID: "library"}, log: NewMockLogger()}
+	defer server.closeAdmin()
+	assert.NoError(t, server.Check(context.Background()))
+
+	// a broker that accepts connections but does not answer Kafka requests
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	tcpOnly := &KafkaServer{options: &KafkaConfig{Brokers: []string{listener.Addr().String()}, GroupID: "library"}, log: NewMockLogger()}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Error(t, tcpOnly.Check(ctx))
+
+	server = &KafkaServer{options: &KafkaConfig{}}
+	assert.ErrorIs(t, server.Check(context.Background()), ErrAdminDisabled)
+}
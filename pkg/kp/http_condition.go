@@ -0,0 +1,181 @@
+package kp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RetryCondition is a condition on the status and the body of a response,
+// see parseRetryCondition.
+type RetryCondition func(status int, body []byte) bool
+
+var comparison = regexp.MustCompile(`^(status|body(?:\.[\w.-]+)?)\s*(==|!=|>=|<=|>|<|contains)\s*(.+)$`)
+
+// parseRetryCondition parses the RetryCondition of RequestAttributes, i.e.
+// comparisons joined by && and ||, with && binding tighter:
+//
+//	status >= 500 || status == 429
+//	body.code == "E503" && status != 200
+//	body contains "try again"
+//
+// status is the status code and body the raw body. body.path is a field of a
+// JSON body, a number in the path indexes an array. Values are JSON literals,
+// a bare word is a string.
+func parseRetryCondition(expr string) (RetryCondition, error) {
+	clauses, err := splitCondition(expr)
+	if err != nil {
+		return nil, fmt.Errorf("retry condition %q: %w", expr, err)
+	}
+
+	var anyOf [][]func(int, []byte) bool
+	for _, or := range clauses {
+		var allOf []func(int, []byte) bool
+		for _, and := range or {
+			cmp, err := parseComparison(strings.TrimSpace(and))
+			if err != nil {
+				return nil, fmt.Errorf("retry condition %q: %w", expr, err)
+			}
+			allOf = append(allOf, cmp)
+		}
+		anyOf = append(anyOf, allOf)
+	}
+
+	return func(status int, body []byte) bool {
+		for _, allOf := range anyOf {
+			ok := true
+			for _, cmp := range allOf {
+				if ok = cmp(status, body); !ok {
+					break
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// splitCondition splits expr on || and then on &&, except inside quoted
+// strings.
+func splitCondition(expr string) ([][]string, error) {
+	var (
+		anyOf  [][]string
+		allOf  []string
+		start  int
+		quoted bool
+	)
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case quoted && expr[i] == '\\':
+			i++
+		case expr[i] == '"':
+			quoted = !quoted
+		case !quoted && i+1 < len(expr) && (expr[i:i+2] == "||" || expr[i:i+2] == "&&"):
+			allOf = append(allOf, expr[start:i])
+			if expr[i] == '|' {
+				anyOf = append(anyOf, allOf)
+				allOf = nil
+			}
+			start = i + 2
+			i++
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated string")
+	}
+	allOf = append(allOf, expr[start:])
+	return append(anyOf, allOf), nil
+}
+
+func parseComparison(s string) (func(int, []byte) bool, error) {
+	m := comparison.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("invalid comparison %q", s)
+	}
+	operand, op, literal := m[1], m[2], strings.TrimSpace(m[3])
+
+	var want any
+	if err := json.Unmarshal([]byte(literal), &want); err != nil {
+		want = literal
+	}
+
+	switch {
+	case operand == "status":
+		code, ok := want.(float64)
+		if !ok {
+			return nil, fmt.Errorf("status compared to %s, not a number", literal)
+		}
+		return func(status int, _ []byte) bool {
+			return compare(float64(status), op, code)
+		}, nil
+	case operand == "body":
+		return func(_ int, body []byte) bool {
+			return compare(string(body), op, fmt.Sprint(want))
+		}, nil
+	default:
+		path := strings.Split(strings.TrimPrefix(operand, "body."), ".")
+		return func(_ int, body []byte) bool {
+			var v any
+			if err := json.Unmarshal(body, &v); err != nil {
+				return false
+			}
+			got, ok := lookup(v, path)
+			return ok && compare(got, op, want)
+		}, nil
+	}
+}
+
+func lookup(v any, path []string) (any, bool) {
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func compare(got any, op string, want any) bool {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(got, want)
+	case "!=":
+		return !reflect.DeepEqual(got, want)
+	case "contains":
+		return strings.Contains(fmt.Sprint(got), fmt.Sprint(want))
+	}
+
+	a, ok := got.(float64)
+	b, ok2 := want.(float64)
+	if !ok || !ok2 {
+		return false
+	}
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	default:
+		return a <= b
+	}
+}
@@ -0,0 +1,50 @@
+package kp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryCondition(t *testing.T) {
+	tests := []struct {
+		expr   string
+		status int
+		body   string
+		want   bool
+	}{
+		{"status >= 500", 503, "", true},
+		{"status >= 500", 404, "", false},
+		{"status == 429 || status == 503", 429, "", true},
+		{"status != 200", 200, "", false},
+		{`body contains "try again"`, 200, "please try again later", true},
+		{`body.code == "E503"`, 200, `{"code":"E503"}`, true},
+		{`body.code == E503`, 200, `{"code":"E503"}`, true},
+		{`body.code == "E503"`, 200, `not json`, false},
+		{`body.error.retryable == true && status >= 500`, 502, `{"error":{"retryable":true}}`, true},
+		{`body.error.retryable == true && status >= 500`, 400, `{"error":{"retryable":true}}`, false},
+		{`body.items.0.state == "pending"`, 200, `{"items":[{"state":"pending"}]}`, true},
+		{`body.items.1.state == "pending"`, 200, `{"items":[{"state":"pending"}]}`, false},
+		{`body.attempts < 3`, 200, `{"attempts":2}`, true},
+		{`body contains "a||b"`, 200, "x a||b y", true},
+		{`body contains "a||b"`, 200, "a", false},
+		{`body.msg == "rock && roll" || status == 503`, 200, `{"msg":"rock && roll"}`, true},
+		{`body.msg == "say \"hi||\""`, 200, `{"msg":"say \"hi||\""}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			condition, err := parseRetryCondition(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, condition(tt.status, []byte(tt.body)))
+		})
+	}
+}
+
+func TestParseRetryConditionInvalid(t *testing.T) {
+	for _, expr := range []string{"", "status", "header.x == 1", "status >= high", "status == 500 ||", `body contains "open`} {
+		_, err := parseRetryCondition(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -6,7 +6,12 @@ import (
 	"io"
 	"math/rand/v2"
 	"net/http"
+	"strconv"
 	"time"
+
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type RetryConfig struct {
@@ -62,43 +67,215 @@ func Retry[T any](ctx context.Context, config RetryConfig, operation func() (T,
 // })
 // fmt.Println(result, err)
 
+// RetryRoundTripper retries a request that failed in transport or got one of
+// the retry status codes, waiting at least the Retry-After of the response.
+// Only idempotent methods are retried unless WithNonIdempotentRetry is set.
+// The response of the last attempt is returned with its body unread.
 type RetryRoundTripper struct {
-	next   http.RoundTripper
-	config RetryConfig
+	next          http.RoundTripper
+	config        RetryConfig
+	statusCodes   map[int]bool
+	condition     RetryCondition
+	nonIdempotent bool
+}
+
+type RetryRoundTripperOption func(*RetryRoundTripper)
+
+// WithRetryStatusCodes replaces the status codes that are retried, 429, 502,
+// 503 and 504 by default.
+func WithRetryStatusCodes(codes ...int) RetryRoundTripperOption {
+	return func(rrt *RetryRoundTripper) {
+		rrt.statusCodes = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			rrt.statusCodes[code] = true
+		}
+	}
+}
+
+// WithRetryCondition retries the responses matching condition instead of the
+// retry status codes. The body it reads is still returned intact.
+func WithRetryCondition(condition RetryCondition) RetryRoundTripperOption {
+	return func(rrt *RetryRoundTripper) {
+		rrt.condition = condition
+	}
 }
 
-func NewRetryRoundTripper(next http.RoundTripper, config RetryConfig) *RetryRoundTripper {
+// WithNonIdempotentRetry also retries POST, PATCH and the other methods that
+// are not idempotent, e.g. for a server that dedupes with an idempotency key.
+func WithNonIdempotentRetry() RetryRoundTripperOption {
+	return func(rrt *RetryRoundTripper) {
+		rrt.nonIdempotent = true
+	}
+}
+
+func NewRetryRoundTripper(next http.RoundTripper, config RetryConfig, opts ...RetryRoundTripperOption) *RetryRoundTripper {
 	if next == nil {
 		next = http.DefaultTransport
 	}
-	return &RetryRoundTripper{
+	rrt := &RetryRoundTripper{
 		next:   next,
 		config: config,
+		statusCodes: map[int]bool{
+			http.StatusTooManyRequests:    true,
+			http.StatusBadGateway:         true,
+			http.StatusServiceUnavailable: true,
+			http.StatusGatewayTimeout:     true,
+		},
+	}
+	for _, opt := range opts {
+		opt(rrt)
 	}
+	return rrt
+}
+
+type retryLogKey struct{}
+
+type retryLog struct {
+	detailLog         logger.DetailLog
+	node, cmd, invoke string
+}
+
+// ContextWithRetryLog makes RetryRoundTripper record the attempts it retries
+// of the requests made with ctx in detailLog.
+func ContextWithRetryLog(ctx context.Context, detailLog logger.DetailLog, node, cmd, invoke string) context.Context {
+	return context.WithValue(ctx, retryLogKey{}, retryLog{detailLog: detailLog, node: node, cmd: cmd, invoke: invoke})
+}
+
+// RetryAttempt is the detail log entry of one attempt of RetryRoundTripper.
+type RetryAttempt struct {
+	Attempt    int    `json:"attempt"`
+	Status     int    `json:"status,omitempty"`
+	Error      string `json:"error,omitempty"`
+	RetryAfter string `json:"retryAfter,omitempty"`
 }
 
 func (rrt *RetryRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	operation := func() (*http.Response, error) {
-		reqCopy := req.Clone(req.Context())
-		if req.Body != nil {
-			bodyBytes, err := io.ReadAll(req.Body)
-			if err != nil {
-				return nil, err
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	ctx := req.Context()
+	delay := rrt.config.InitialDelay
+	for attempt := 1; ; attempt++ {
+		reqCopy := req.Clone(ctx)
+		if body != nil {
+			reqCopy.Body = io.NopCloser(bytes.NewReader(body))
+			reqCopy.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(body)), nil
 			}
-			reqCopy.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 		}
 
 		resp, err := rrt.next.RoundTrip(reqCopy)
-		if err != nil {
-			return nil, err
+		retry := attempt < rrt.config.MaxAttempts && rrt.retryable(req, resp, err)
+
+		wait := time.Duration(0)
+		if retry {
+			jitter := time.Duration(rand.Float64() * float64(delay))
+			wait = min(delay+jitter, rrt.config.MaxDelay)
+			if retryAfter, ok := parseRetryAfter(resp); ok && retryAfter > wait {
+				wait = retryAfter
+			}
+			// no point in waiting past the deadline of the request
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				retry = false
+			}
 		}
-		resp.Body.Close()
+		recordAttempt(ctx, attempt, resp, err, retry, wait)
+		if !retry {
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+			delay *= 2
+		}
+	}
+}
+
+func (rrt *RetryRoundTripper) retryable(req *http.Request, resp *http.Response, err error) bool {
+	if !rrt.nonIdempotent && !idempotent(req.Method) {
+		return false
+	}
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+	if rrt.condition == nil {
+		return rrt.statusCodes[resp.StatusCode]
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+	return rrt.condition(resp.StatusCode, body)
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseRetryAfter reads the Retry-After header, in seconds or as an HTTP date.
+func parseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
 
-		return resp, nil
+// recordAttempt adds an attempt to the span of the request and, when it is
+// retried, to the detail log of ContextWithRetryLog. The caller logs the
+// response of the last attempt.
+func recordAttempt(ctx context.Context, attempt int, resp *http.Response, err error, retry bool, wait time.Duration) {
+	entry := RetryAttempt{Attempt: attempt}
+	attrs := []attribute.KeyValue{attribute.Int("http.attempt", attempt), attribute.Bool("http.retry", retry)}
+	if resp != nil {
+		entry.Status = resp.StatusCode
+		attrs = append(attrs, attribute.Int("http.status_code", resp.StatusCode))
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		attrs = append(attrs, attribute.String("http.error", err.Error()))
 	}
+	if retry {
+		entry.RetryAfter = wait.String()
+		attrs = append(attrs, attribute.String("http.retry_after", wait.String()))
+	}
+	trace.SpanFromContext(ctx).AddEvent("http.attempt", trace.WithAttributes(attrs...))
 
-	return Retry(req.Context(), rrt.config, operation)
+	if !retry {
+		return
+	}
+	if l, ok := ctx.Value(retryLogKey{}).(retryLog); ok && l.detailLog != nil {
+		l.detailLog.AddInputResponse(l.node, l.cmd, l.invoke, nil, entry)
+	}
 }
 
 // config := RetryConfig{
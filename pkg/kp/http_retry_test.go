@@ -0,0 +1,189 @@
+package kp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+var testRetryConfig = RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+// flakyServer answers with the statuses in order, then with 200 "ok".
+func flakyServer(t *testing.T, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n := int(calls.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			w.Write([]byte("attempt failed"))
+			return
+		}
+		w.Write(append([]byte("ok "), body...))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryRoundTripperRetriesStatusCodes(t *testing.T) {
+	srv, calls := flakyServer(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	client := &http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok ", string(body))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryRoundTripperReturnsLastResponse(t *testing.T) {
+	srv, calls := flakyServer(t, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	client := &http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}
+
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, "attempt failed", string(body))
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRetryRoundTripperStatusCodes(t *testing.T) {
+	srv, calls := flakyServer(t, http.StatusInternalServerError)
+
+	resp, err := (&http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "500 is not retried by default")
+
+	calls.Store(0)
+	transport := NewRetryRoundTripper(nil, testRetryConfig, WithRetryStatusCodes(http.StatusInternalServerError))
+	resp, err = (&http.Client{Transport: transport}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRetryRoundTripperNonIdempotent(t *testing.T) {
+	srv, calls := flakyServer(t, http.StatusServiceUnavailable)
+
+	resp, err := (&http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}).Post(srv.URL, "text/plain", strings.NewReader("book"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	transport := NewRetryRoundTripper(nil, testRetryConfig, WithNonIdempotentRetry())
+	resp, err = (&http.Client{Transport: transport}).Post(srv.URL, "text/plain", strings.NewReader("book"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "ok book", string(body), "the request body is sent again")
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestRetryRoundTripperRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// a Retry-After past the deadline of the request returns the response
+	calls.Store(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err = (&http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	header := func(v string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {v}}}
+	}
+
+	d, ok := parseRetryAfter(header("3"))
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	d, ok = parseRetryAfter(header(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)))
+	assert.True(t, ok)
+	assert.InDelta(t, time.Minute, d, float64(2*time.Second))
+
+	_, ok = parseRetryAfter(header("soon"))
+	assert.False(t, ok)
+	_, ok = parseRetryAfter(nil)
+	assert.False(t, ok)
+}
+
+type attemptLog struct {
+	logger.DetailLog
+	attempts []RetryAttempt
+}
+
+func (l *attemptLog) AddInputResponse(node, cmd, invoke string, rawData, data any) {
+	l.attempts = append(l.attempts, data.(RetryAttempt))
+}
+
+func TestRetryRoundTripperRecordsAttempts(t *testing.T) {
+	recorder := useTestTracer(t)
+	srv, _ := flakyServer(t, http.StatusServiceUnavailable)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "books")
+	detailLog := &attemptLog{}
+	ctx = ContextWithRetryLog(ctx, detailLog, "books", "get_book", "inv-1")
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	resp, err := (&http.Client{Transport: NewRetryRoundTripper(nil, testRetryConfig)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	span.End()
+
+	require.Len(t, detailLog.attempts, 1, "the last attempt is logged by the caller")
+	assert.Equal(t, 1, detailLog.attempts[0].Attempt)
+	assert.Equal(t, http.StatusServiceUnavailable, detailLog.attempts[0].Status)
+	assert.NotEmpty(t, detailLog.attempts[0].RetryAfter)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, "http.attempt", events[0].Name)
+}
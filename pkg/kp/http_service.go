@@ -9,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -27,6 +28,12 @@ const (
 	DELETE HTTPMethod = "DELETE"
 )
 
+// RequestAttributes describes a request of RequestHttp. RetryCount retries a
+// failed request, on the status codes of RetryRoundTripper or when the
+// RetryCondition matches, see parseRetryCondition. Only idempotent methods are
+// retried, unless RetryNonIdempotent is set or the request has an
+// Idempotency-Key header. A status outside StatusSuccess, 2xx by default, is
+// an error.
 type RequestAttributes struct {
 	Headers        TMap
 	Method         HTTPMethod
@@ -42,8 +49,19 @@ type RequestAttributes struct {
 	URL            string
 	Auth           *BasicAuth
 	StatusSuccess  []int
+
+	RetryNonIdempotent bool
 }
 
+// ErrUnexpectedStatus is the error of a response whose status is not in
+// RequestAttributes.StatusSuccess.
+var ErrUnexpectedStatus = errors.New("unexpected http status")
+
+const (
+	requestRetryDelay    = 100 * time.Millisecond
+	requestRetryMaxDelay = 2 * time.Second
+)
+
 type OptionAttributes interface{}
 
 type BasicAuth struct {
@@ -51,6 +69,15 @@ type BasicAuth struct {
 	Password string
 }
 
+// redacted is the copy of the credentials written to the detail log, the
+// password is masked.
+func (a *BasicAuth) redacted() *BasicAuth {
+	if a == nil {
+		return nil
+	}
+	return &BasicAuth{Username: a.Username, Password: "***"}
+}
+
 // attr.Service, attr.Command, attr.Invoke
 type attrDetailLog struct {
 	Service string
@@ -116,7 +143,7 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 				Method:      attr.Method,
 				RetryCount:  attr.RetryCount,
 				Timeout:     attr.Timeout,
-				Auth:        attr.Auth,
+				Auth:        attr.Auth.redacted(),
 			}
 
 			// Path param substitution
@@ -143,13 +170,20 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 
 			detailLog.AddOutputRequest(attr.Service, attr.Command, attr.Invoke, processLog, processLog, "http", strings.ToLower(string(attr.Method)))
 
+			if attr.RetryCount > 0 {
+				ctx = ContextWithRetryLog(ctx, detailLog, attr.Service, attr.Command, attr.Invoke)
+			}
 			resp, err := SendRequest(ctx, RequestAttr{
-				Method:  string(attr.Method),
-				URL:     attr.URL,
-				Headers: attr.Headers,
-				Body:    attr.Body,
-				Timeout: attr.Timeout,
-				Service: attr.Service,
+				Method:             string(attr.Method),
+				URL:                attr.URL,
+				Headers:            attr.Headers,
+				Body:               attr.Body,
+				Timeout:            attr.Timeout,
+				Service:            attr.Service,
+				RetryCount:         attr.RetryCount,
+				RetryCondition:     attr.RetryCondition,
+				RetryNonIdempotent: attr.RetryNonIdempotent,
+				Auth:               attr.Auth,
 			})
 
 			if err != nil {
@@ -162,6 +196,8 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 			}
 			defer resp.Body.Close()
 
+			statusErr := checkStatus(resp, attr.StatusSuccess)
+
 			bodyBytes, err := io.ReadAll(resp.Body)
 			if err != nil {
 				responseChan <- ApiResponse{
@@ -180,7 +216,7 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 					attr:       attrDetailLog{Service: attr.Service, Command: attr.Command, Invoke: attr.Invoke, Method: attr.Method},
 					RawBody:    string(bodyBytes),
 					StatusText: resp.Status,
-					Err:        err,
+					Err:        errors.Join(statusErr, err),
 				}
 				return
 			}
@@ -192,6 +228,7 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 				Body:       body,
 				RawBody:    string(bodyBytes),
 				StatusText: resp.Status,
+				Err:        statusErr,
 			}
 		}(ctx.Context(), attrCopy)
 	}
@@ -199,13 +236,19 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 	wg.Wait()
 	close(responseChan)
 
+	var errs []error
 	for response := range responseChan {
 		service := response.attr.Service
 		command := response.attr.Command
 		invoke := response.attr.Invoke
 
 		resultCode := fmt.Sprintf("%d", response.Status)
-		summaryLog.AddSuccess(service, command, resultCode, response.StatusText)
+		if response.Err != nil {
+			summaryLog.AddError(service, command, resultCode, response.Err.Error())
+			errs = append(errs, response.Err)
+		} else {
+			summaryLog.AddSuccess(service, command, resultCode, response.StatusText)
+		}
 		detailLog.AddInputResponse(service, command, invoke, nil, response)
 
 		mu.Lock()
@@ -214,9 +257,21 @@ func RequestHttp(ctx IContext, optionAttributes OptionAttributes) (any, error) {
 	}
 
 	if len(responses) == 1 {
-		return responses[0].Body, nil
+		return responses[0].Body, responses[0].Err
 	}
-	return responses, nil
+	return responses, errors.Join(errs...)
+}
+
+// checkStatus reports a status outside success, 2xx when it is empty.
+func checkStatus(resp *http.Response, success []int) error {
+	if len(success) == 0 {
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+	} else if slices.Contains(success, resp.StatusCode) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
 }
 
 // func RequestHttp(optionAttributes OptionAttributes, detailLog logger.DetailLog, summaryLog logger.SummaryLog) (any, error) {
@@ -358,6 +413,14 @@ type RequestAttr struct {
 	Body    any
 	Timeout int // in seconds
 	Service string
+
+	// RetryCount retries the request through a RetryRoundTripper. A POST or
+	// PATCH is only retried with RetryNonIdempotent or an Idempotency-Key
+	// header, the server could apply it twice.
+	RetryCount         int
+	RetryCondition     string
+	RetryNonIdempotent bool
+	Auth               *BasicAuth
 }
 
 func SendRequest(c context.Context, attr RequestAttr) (*http.Response, error) {
@@ -389,10 +452,32 @@ func SendRequest(c context.Context, attr RequestAttr) (*http.Response, error) {
 		req.Header.Set(key, value)
 	}
 
-	// Send request
+	if attr.Auth != nil {
+		req.SetBasicAuth(attr.Auth.Username, attr.Auth.Password)
+	}
+
+	// Send request, the timeout covers the retries
 	httpClient := &http.Client{
 		Timeout: time.Duration(attr.Timeout) * time.Second,
 	}
+	if attr.RetryCount > 0 {
+		var opts []RetryRoundTripperOption
+		if attr.RetryNonIdempotent || req.Header.Get("Idempotency-Key") != "" {
+			opts = append(opts, WithNonIdempotentRetry())
+		}
+		if attr.RetryCondition != "" {
+			condition, err := parseRetryCondition(attr.RetryCondition)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithRetryCondition(condition))
+		}
+		httpClient.Transport = NewRetryRoundTripper(http.DefaultTransport, RetryConfig{
+			MaxAttempts:  attr.RetryCount + 1,
+			InitialDelay: requestRetryDelay,
+			MaxDelay:     requestRetryMaxDelay,
+		}, opts...)
+	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
 		fmt.Println("Error sending request: ===============>", err)
@@ -0,0 +1,174 @@
+package kp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestHttpRetries(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Write([]byte(`{"status":"pending"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"done"}`))
+	}))
+	defer srv.Close()
+
+	ctx := NewMockContext()
+	result, err := RequestHttp(ctx, RequestAttributes{
+		Method:         GET,
+		URL:            srv.URL,
+		Service:        "books",
+		Command:        "get_book",
+		RetryCount:     3,
+		RetryCondition: `body.status == "pending"`,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"status": "done"}, result)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestRequestHttpWithoutRetryCount(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	_, err := RequestHttp(NewMockContext(), RequestAttributes{Method: GET, URL: srv.URL})
+
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRequestHttpAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	_, err := RequestHttp(NewMockContext(), RequestAttributes{
+		Method: GET,
+		URL:    srv.URL,
+		Auth:   &BasicAuth{Username: "admin", Password: "secret"},
+	})
+	assert.NoError(t, err)
+}
+
+type requestDetailLog struct {
+	*MockDetailLog
+	requests []any
+}
+
+func (l *requestDetailLog) AddOutputRequest(node, cmd, invoke string, rawData, data any, protocol, protocolMethod string) {
+	l.requests = append(l.requests, data)
+}
+
+type requestLogContext struct {
+	*MockContext
+	detailLog *requestDetailLog
+}
+
+func (c *requestLogContext) DetailLog() logger.DetailLog {
+	return c.detailLog
+}
+
+func TestRequestHttpAuthRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	ctx := &requestLogContext{MockContext: NewMockContext(), detailLog: &requestDetailLog{MockDetailLog: &MockDetailLog{methodsToCall: map[string]bool{}}}}
+	_, err := RequestHttp(ctx, RequestAttributes{
+		Method: GET,
+		URL:    srv.URL,
+		Auth:   &BasicAuth{Username: "admin", Password: "secret"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, ctx.detailLog.requests, 1)
+	logged, err := json.Marshal(ctx.detailLog.requests[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(logged), `"Username":"admin"`)
+	assert.NotContains(t, string(logged), "secret")
+}
+
+func TestRequestHttpStatusSuccess(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer srv.Close()
+
+	ctx := NewMockContext()
+	result, err := RequestHttp(ctx, RequestAttributes{Method: GET, URL: srv.URL})
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	assert.Equal(t, map[string]any{"error": "not found"}, result, "the body of the error is kept")
+	summaryLog := ctx.summaryLog.(*MockSummaryLog)
+	assert.True(t, summaryLog.methodsToCall["AddError"])
+	assert.False(t, summaryLog.methodsToCall["AddSuccess"])
+
+	ctx = NewMockContext()
+	_, err = RequestHttp(ctx, RequestAttributes{Method: GET, URL: srv.URL, StatusSuccess: []int{http.StatusOK, http.StatusNotFound}})
+	assert.NoError(t, err)
+	assert.True(t, ctx.summaryLog.(*MockSummaryLog).methodsToCall["AddSuccess"])
+}
+
+func TestRequestHttpInvalidRetryCondition(t *testing.T) {
+	_, err := RequestHttp(NewMockContext(), RequestAttributes{
+		Method:         GET,
+		URL:            "http://localhost:0",
+		RetryCount:     1,
+		RetryCondition: "status is bad",
+	})
+	assert.ErrorContains(t, err, "retry condition")
+}
+
+func TestRequestHttpRetriesPostOnlyWhenAllowed(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	post := RequestAttributes{Method: POST, URL: srv.URL, Body: TMap{"title": "go"}, RetryCount: 2}
+
+	_, err := RequestHttp(NewMockContext(), post)
+	assert.ErrorIs(t, err, ErrUnexpectedStatus)
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	allowed := post
+	allowed.RetryNonIdempotent = true
+	_, err = RequestHttp(NewMockContext(), allowed)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+
+	calls.Store(0)
+	keyed := post
+	keyed.Headers = TMap{"Idempotency-Key": "book-1"}
+	_, err = RequestHttp(NewMockContext(), keyed)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
@@ -0,0 +1,118 @@
+package kp
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// HeaderMessageID identifies a message across redeliveries. The producer sets
+// it on every message that does not carry one.
+const HeaderMessageID = "x-message-id"
+
+// ProcessedStore remembers the messages whose handler succeeded, see
+// ConsumerOptions.Processed.
+type ProcessedStore interface {
+	IsProcessed(ctx context.Context, id string) (bool, error)
+	MarkProcessed(ctx context.Context, id string) error
+}
+
+// MessageID is the key of a message in a ProcessedStore: its x-message-id
+// header, or else the topic, partition and offset it was first consumed from.
+// A message moved to a retry topic keeps the ID of the original.
+func MessageID(message *sarama.ConsumerMessage) string {
+	headers := recordHeaders(message.Headers)
+	if id := headers[HeaderMessageID]; id != "" {
+		return id
+	}
+	if origin := headers[HeaderOriginTopic]; origin != "" {
+		return fmt.Sprintf("%s/%s/%s", origin, headers[HeaderOriginPartition], headers[HeaderOriginOffset])
+	}
+	return fmt.Sprintf("%s/%d/%d", message.Topic, message.Partition, message.Offset)
+}
+
+// isDuplicate reports whether the message was already processed. A store that
+// fails is logged and the message handled, a duplicate is better than a loss.
+func (s *KafkaServer) isDuplicate(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, route consumerRoute) bool {
+	store := route.options.Processed
+	if store == nil {
+		return false
+	}
+
+	ctx := session.Context()
+	id := MessageID(message)
+	processed, err := store.IsProcessed(ctx, id)
+	if err != nil {
+		s.log.Printf("Processed store error on %s: %v", id, err)
+		return false
+	}
+	if !processed {
+		return false
+	}
+
+	kctx := newMessageContext(ctx, message, s.producer, s.log)
+	kctx.CommonLog("consume", message.Topic)
+	kctx.SummaryLog().AddSuccess("kafka", "duplicate", "", id)
+	kctx.SummaryLog().End("200", "duplicate skipped")
+	return true
+}
+
+func (s *KafkaServer) markProcessed(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, route consumerRoute) {
+	store := route.options.Processed
+	if store == nil {
+		return
+	}
+
+	id := MessageID(message)
+	if err := store.MarkProcessed(session.Context(), id); err != nil {
+		s.log.Printf("Processed store error on %s: %v", id, err)
+	}
+}
+
+// MemoryProcessedStore keeps the IDs of the last size processed messages. It
+// only covers the redeliveries seen by one instance, e.g. after a rebalance
+// that gives the partition back to it.
+type MemoryProcessedStore struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+func NewMemoryProcessedStore(size int) *MemoryProcessedStore {
+	if size <= 0 {
+		size = 10000
+	}
+	return &MemoryProcessedStore{size: size, order: list.New(), ids: make(map[string]*list.Element)}
+}
+
+func (s *MemoryProcessedStore) IsProcessed(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.ids[id]
+	if ok {
+		s.order.MoveToFront(e)
+	}
+	return ok, nil
+}
+
+func (s *MemoryProcessedStore) MarkProcessed(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.ids[id]; ok {
+		s.order.MoveToFront(e)
+		return nil
+	}
+	s.ids[id] = s.order.PushFront(id)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.ids, oldest.Value.(string))
+	}
+	return nil
+}
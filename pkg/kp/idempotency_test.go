@@ -0,0 +1,111 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+type summaryRecordingLogger struct {
+	*MockLogger
+	summaryLogs []*MockSummaryLog
+}
+
+func (l *summaryRecordingLogger) NewLog(ctx context.Context, initInvoke, scenario string) (logger.DetailLog, logger.SummaryLog) {
+	detailLog, summaryLog := l.MockLogger.NewLog(ctx, initInvoke, scenario)
+	l.summaryLogs = append(l.summaryLogs, summaryLog.(*MockSummaryLog))
+	return detailLog, summaryLog
+}
+
+func (l *summaryRecordingLogger) Session(v string) ILogger {
+	l.MockLogger.Session(v)
+	return l
+}
+
+func TestMessageID(t *testing.T) {
+	message := &sarama.ConsumerMessage{Topic: "orders", Partition: 1, Offset: 42}
+	assert.Equal(t, "orders/1/42", MessageID(message))
+
+	retried := &sarama.ConsumerMessage{Topic: "orders.retry.1", Partition: 0, Offset: 3, Headers: []*sarama.RecordHeader{
+		{Key: []byte(HeaderOriginTopic), Value: []byte("orders")},
+		{Key: []byte(HeaderOriginPartition), Value: []byte("1")},
+		{Key: []byte(HeaderOriginOffset), Value: []byte("42")},
+	}}
+	assert.Equal(t, "orders/1/42", MessageID(retried))
+
+	retried.Headers = append(retried.Headers, &sarama.RecordHeader{Key: []byte(HeaderMessageID), Value: []byte("m-1")})
+	assert.Equal(t, "m-1", MessageID(retried))
+}
+
+func TestMemoryProcessedStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryProcessedStore(2)
+
+	assert.NoError(t, store.MarkProcessed(ctx, "a"))
+	assert.NoError(t, store.MarkProcessed(ctx, "b"))
+	processed, _ := store.IsProcessed(ctx, "a")
+	assert.True(t, processed)
+
+	assert.NoError(t, store.MarkProcessed(ctx, "c"))
+	processed, _ = store.IsProcessed(ctx, "b")
+	assert.False(t, processed)
+	processed, _ = store.IsProcessed(ctx, "a")
+	assert.True(t, processed)
+}
+
+func TestConsumeClaimSkipsProcessedMessages(t *testing.T) {
+	log := &summaryRecordingLogger{MockLogger: NewMockLogger()}
+	store := NewMemoryProcessedStore(10)
+
+	calls := 0
+	server := &KafkaServer{log: log}
+	server.ConsumeWithOptions("orders", ConsumerOptions{Processed: store}, func(ctx IContext) error {
+		calls++
+		return nil
+	})
+
+	message := &sarama.ConsumerMessage{Topic: "orders", Partition: 0, Offset: 5, Value: []byte(`{}`)}
+	session, err := consumeMessages(server, message, message)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	session.AssertNumberOfCalls(t, "MarkMessage", 2)
+	if assert.Len(t, log.summaryLogs, 1) {
+		assert.True(t, log.summaryLogs[0].methodsToCall["AddSuccess"])
+		assert.True(t, log.summaryLogs[0].methodsToCall["End"])
+	}
+}
+
+func TestConsumeClaimDoesNotMarkFailedMessages(t *testing.T) {
+	store := NewMemoryProcessedStore(10)
+	server := &KafkaServer{log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{Processed: store}, func(ctx IContext) error {
+		return errors.New("boom")
+	})
+
+	message := &sarama.ConsumerMessage{Topic: "orders", Partition: 0, Offset: 5, Value: []byte(`{}`)}
+	_, err := consumeMessages(server, message)
+
+	assert.NoError(t, err)
+	processed, _ := store.IsProcessed(context.Background(), MessageID(message))
+	assert.False(t, processed)
+}
+
+func TestProducerSetsMessageID(t *testing.T) {
+	var id string
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		id = headerMap(msg.Headers)[HeaderMessageID]
+		return nil
+	})
+
+	_, err := producer(context.Background(), mockProducer, JSONCodec{}, topic, map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	assert.NotEmpty(t, id)
+}
@@ -2,6 +2,7 @@ package kp
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -15,8 +16,16 @@ type KafkaServer struct {
 	options  *KafkaConfig
 	mutex    sync.Mutex
 	handlers map[string]ServiceHandleFunc
+	routes   map[string]consumerRoute
+	async    *asyncProducer
 	topics   []string
+	patterns []topicPattern
 	log      ILogger
+
+	deadLetters map[string]bool
+	flow        flowControl
+
+	consumeErr error
 }
 
 func NewKafkaServer(producer sarama.SyncProducer, client sarama.ConsumerGroup, options *KafkaConfig, log ILogger) (*KafkaServer, error) {
@@ -25,12 +34,13 @@ func NewKafkaServer(producer sarama.SyncProducer, client sarama.ConsumerGroup, o
 		producer: producer,
 		options:  options,
 		handlers: make(map[string]ServiceHandleFunc),
+		routes:   make(map[string]consumerRoute),
 		log:      log,
 	}, nil
 }
 
 func (s *KafkaServer) StartConsumer(ctx context.Context) error {
-	if len(s.topics) == 0 {
+	if len(s.topics) == 0 && len(s.patterns) == 0 {
 		return nil
 	}
 
@@ -41,8 +51,11 @@ func (s *KafkaServer) StartConsumer(ctx context.Context) error {
 			s.log.Println("Stopping Kafka consumer...")
 			return nil
 		default:
-			if err := s.client.Consume(ctx, s.topics, s); err != nil {
+			if err := s.consume(ctx); err != nil {
 				s.log.Printf("Error consuming messages: %v", err)
+				s.mutex.Lock()
+				s.consumeErr = err
+				s.mutex.Unlock()
 				time.Sleep(time.Second) // Avoid tight loop on failure
 				return err
 			}
@@ -50,61 +63,270 @@ func (s *KafkaServer) StartConsumer(ctx context.Context) error {
 	}
 
 }
+
+// consume runs one consumer group session. With pattern subscriptions the
+// session also ends when the topics matching them change, the next session
+// subscribes the new list.
+func (s *KafkaServer) consume(ctx context.Context) error {
+	topics, ok := s.waitSubscription(ctx)
+	if !ok {
+		return nil
+	}
+	client := s.consumerGroup()
+	if client == nil {
+		return errors.New("kafka consumer is closed")
+	}
+	if len(s.patterns) == 0 {
+		return client.Consume(ctx, topics, s)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.watchTopics(ctx, topics, cancel)
+
+	// nothing to consume until a matching topic is created
+	if len(topics) == 0 {
+		<-ctx.Done()
+		return nil
+	}
+	return client.Consume(ctx, topics, s)
+}
+
+// Shutdown closes the consumer group and the reply consumer, then flushes and
+// closes the producers and the admin client.
 func (s *KafkaServer) Shutdown() {
+	s.closeConsumer()
+	s.closeReplies()
+	s.closeProducers()
+	s.closeAdmin()
+}
+
+// closeConsumer closes the consumer group outside s.mutex, Close waits for
+// the handlers of the session, which may need it.
+func (s *KafkaServer) closeConsumer() {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	client := s.client
+	s.client = nil
+	s.mutex.Unlock()
 
-	if s.client == nil {
+	if client == nil {
 		return
 	}
 
 	s.log.Println("Closing Kafka consumer...")
-	if err := s.client.Close(); err != nil {
+	if err := client.Close(); err != nil {
 		s.log.Printf("Error closing Kafka consumer: %v", err)
 	}
+}
+
+// consumerGroup returns the consumer group, nil once it is closed.
+func (s *KafkaServer) consumerGroup() sarama.ConsumerGroup {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.client
+}
+
+// closeProducers waits for the async producer to deliver the queued messages
+// before closing the sync producer.
+// closeProducers flushes and closes the producers outside the mutex, the
+// OnDelivery callbacks of the pending messages may call back into s.
+func (s *KafkaServer) closeProducers() {
+	s.mutex.Lock()
+	async, producer := s.async, s.producer
+	s.mutex.Unlock()
+
+	if async != nil {
+		s.log.Println("Flushing Kafka async producer...")
+		async.Close()
+	}
+
+	if producer == nil {
+		return
+	}
 
 	s.log.Println("Closing Kafka producer...")
-	if err := s.producer.Close(); err != nil {
+	if err := producer.Close(); err != nil {
 		s.log.Printf("Error closing Kafka producer: %v", err)
 	}
 }
 
+func (s *KafkaServer) consumerError() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.consumeErr
+}
+
 func (s *KafkaServer) SendMessage(c context.Context, topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error) {
-	_, span := otel.GetTracerProvider().Tracer("gokp").Start(c, "kafka-producer-"+topic)
+	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c, "kafka-producer-"+topic)
+	defer span.End()
+	return producer(ctx, s.producer, s.options.codec(topic), topic, payload, opts...)
+}
+
+// SendMessages publishes the payloads with one call of the batch API of the
+// sync producer.
+func (s *KafkaServer) SendMessages(c context.Context, topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c, "kafka-producer-"+topic)
+	defer span.End()
+	return sendMessages(ctx, s.producer, s.options.codec(topic), topic, payloads, opts...)
+}
+
+// SendMessageAsync queues the payload on the async producer, the outcome is
+// reported to AsyncProducerConfig.OnDelivery.
+func (s *KafkaServer) SendMessageAsync(c context.Context, topic string, payload any, opts ...OptionProducerMsg) error {
+	ctx, span := otel.GetTracerProvider().Tracer("gokp").Start(c, "kafka-producer-"+topic)
 	defer span.End()
-	return producer(s.producer, topic, payload, opts...)
+	return sendMessageAsync(ctx, s.async, s.options.codec(topic), topic, payload, opts...)
+}
+
+// SetCodec sets the codec that encodes the messages sent to topic and decodes
+// the messages consumed from it and from its retry topics.
+func (s *KafkaServer) SetCodec(topic string, codec Codec) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.options == nil {
+		s.options = &KafkaConfig{}
+	}
+	if s.options.codecs == nil {
+		s.options.codecs = newCodecs()
+	}
+	s.options.codecs.set(topic, codec)
 }
 
-func (s *KafkaServer) Consume(topic string, handler ServiceHandleFunc) {
-	s.topics = append(s.topics, topic)
+// Codec returns the codec of topic, JSONCodec unless SetCodec replaced it.
+func (s *KafkaServer) Codec(topic string) Codec {
 	s.mutex.Lock()
-	s.handlers[topic] = handler
 	defer s.mutex.Unlock()
+	return s.options.codec(topic)
 }
 
-func (s *KafkaServer) Setup(_ sarama.ConsumerGroupSession) error {
+// Consume registers the handler of a topic. The middlewares wrap the handler
+// the same way route middlewares do for HTTP.
+func (s *KafkaServer) Consume(topic string, handler ServiceHandleFunc, middlewares ...Middleware) {
+	s.ConsumeWithOptions(topic, ConsumerOptions{}, handler, middlewares...)
+}
+
+// ConsumeWithOptions is Consume with retries and a dead-letter topic for
+// messages whose handler fails, see ConsumerOptions. The retry topics are
+// subscribed with the same handler.
+func (s *KafkaServer) ConsumeWithOptions(topic string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.addRoutes(topic, opts, handler, middlewares)
+}
+
+// addRoutes registers the handler of topic and of its retry topics and
+// returns it wrapped in the middlewares. An empty topic only registers the
+// retry topics, as for a pattern.
+func (s *KafkaServer) addRoutes(topic string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares []Middleware) ServiceHandleFunc {
+	if len(middlewares) > 0 {
+		handler = ServiceHandleFunc(preHandle(HandleFunc(handler), middlewares...))
+	}
+	if s.handlers == nil {
+		s.handlers = make(map[string]ServiceHandleFunc)
+	}
+	if s.routes == nil {
+		s.routes = make(map[string]consumerRoute)
+	}
+	if opts.DeadLetterTopic != "" {
+		if s.deadLetters == nil {
+			s.deadLetters = make(map[string]bool)
+		}
+		s.deadLetters[opts.DeadLetterTopic] = true
+	}
+
+	chain := opts.RetryTopics
+	if topic != "" {
+		chain = append([]string{topic}, opts.RetryTopics...)
+	}
+	for i, t := range chain {
+		next := opts.DeadLetterTopic
+		if i+1 < len(chain) {
+			next = chain[i+1]
+		}
+		s.topics = append(s.topics, t)
+		s.handlers[t] = handler
+		s.routes[t] = consumerRoute{options: opts, origin: topic, next: next}
+	}
+	return handler
+}
+
+func (s *KafkaServer) Setup(session sarama.ConsumerGroupSession) error {
+	s.trackClaims(session.Claims())
 	return nil
 }
 
 func (s *KafkaServer) Cleanup(_ sarama.ConsumerGroupSession) error {
+	s.trackClaims(nil)
 	return nil
 }
 
 func (s *KafkaServer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		ctx := NewConsumerContext(message.Topic, string(message.Value), s.producer, s.log)
+	s.pauseClaim(claim)
 
-		handler, exists := s.handlers[message.Topic]
-		if !exists {
-			s.log.Printf("No handler for topic: %s", message.Topic)
-			continue
-		}
+	if _, route, _ := s.route(claim.Topic()); route.options.Concurrency > 1 {
+		return s.consumePool(session, claim, route)
+	}
 
-		if err := handler(ctx); err != nil {
-			s.log.Printf("Handler error: %v", err)
+	for message := range claim.Messages() {
+		if err := s.process(session, message); err != nil {
+			return err
 		}
-
 		session.MarkMessage(message, "")
 	}
 	return nil
 }
+
+// process runs the handler of a message and moves it to the next retry or
+// dead-letter topic when it fails, a request without a retry topic left gets
+// an error reply. An error means the message must not be
+// marked, it is consumed again after the rebalance.
+func (s *KafkaServer) process(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage) error {
+	handler, route, exists := s.route(message.Topic)
+	if !exists {
+		s.log.Printf("No handler for topic: %s", message.Topic)
+		return nil
+	}
+
+	if s.isDuplicate(session, message, route) {
+		return nil
+	}
+
+	if err := s.waitRate(session, message, route); err != nil {
+		return err
+	}
+
+	attempts, err := s.handle(session, message, handler, route)
+	// a dependency is down, wait for it rather than fail the message
+	for err != nil && route.options.CircuitPause > 0 && errors.Is(err, ErrCircuitOpen) {
+		if !s.pauseFor(session, message.Topic, route.options.CircuitPause) {
+			return err
+		}
+		attempts, err = s.handle(session, message, handler, route)
+	}
+	if err != nil {
+		s.log.Printf("Handler error on %s after %d attempts: %v", message.Topic, attempts, err)
+		next := route.next
+		if !retryable(err) {
+			// retry topics cannot fix a permanent failure
+			next = route.options.DeadLetterTopic
+		}
+		if next != "" {
+			if fErr := s.forward(next, message, attempts, err); fErr != nil {
+				s.log.Printf("Failed to forward message to %s: %v", next, fErr)
+				return fErr
+			}
+		}
+		// no retry topic left, a request gets the error as its reply
+		if next == "" || next == route.options.DeadLetterTopic {
+			if rErr := s.replyError(session, message, err); rErr != nil {
+				s.log.Printf("Failed to reply to %s: %v", message.Topic, rErr)
+			}
+		}
+		return nil
+	}
+
+	s.markProcessed(session, message, route)
+	return nil
+}
@@ -0,0 +1,289 @@
+package kp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrAdminDisabled is returned by the admin helpers of a server without
+// brokers.
+var ErrAdminDisabled = errors.New("kafka admin is disabled, no brokers configured")
+
+// TopicConfig describes a topic for EnsureTopics.
+type TopicConfig struct {
+	Name string `json:"name" validate:"required"`
+	// Partitions and ReplicationFactor are 1 when unset.
+	Partitions        int32 `json:"partitions" validate:"min=0"`
+	ReplicationFactor int16 `json:"replicationFactor" validate:"min=0"`
+	// Retention sets retention.ms, the broker default when unset.
+	Retention Duration          `json:"retention"`
+	Configs   map[string]string `json:"configs"`
+}
+
+// TopicDescription is the layout of an existing topic.
+type TopicDescription struct {
+	Name              string `json:"name"`
+	Partitions        int    `json:"partitions"`
+	ReplicationFactor int    `json:"replicationFactor"`
+}
+
+// PartitionLag is how far a consumer group is behind on one partition.
+// Committed is -1 when the group has no offset for the partition yet.
+type PartitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Committed int64  `json:"committed"`
+	Latest    int64  `json:"latest"`
+	Lag       int64  `json:"lag"`
+}
+
+// topicAdmin is the part of sarama's ClusterAdmin and Client used by the
+// admin helpers.
+type topicAdmin interface {
+	ListTopics() (map[string]sarama.TopicDetail, error)
+	CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error
+	DescribeTopics(topics []string) ([]*sarama.TopicMetadata, error)
+	DeleteTopic(topic string) error
+	ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error)
+	GetOffset(topic string, partition int32, time int64) (int64, error)
+	Close() error
+}
+
+type clusterAdmin struct {
+	sarama.ClusterAdmin
+	client sarama.Client
+}
+
+func (a *clusterAdmin) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	return a.client.GetOffset(topic, partition, time)
+}
+
+// ping refreshes the metadata of the cluster, it fails when no broker
+// accepts the connection or the credentials.
+func (a *clusterAdmin) ping() error {
+	if err := a.client.RefreshMetadata(); err != nil {
+		return err
+	}
+	_, err := a.client.Controller()
+	return err
+}
+
+func newClusterAdmin(option *KafkaConfig) (topicAdmin, error) {
+	if option.admin != nil {
+		return option.admin, nil
+	}
+
+	config, err := option.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(option.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	// closing the admin closes the client
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &clusterAdmin{ClusterAdmin: admin, client: client}, nil
+}
+
+// admin connects the cluster admin on first use. The brokers are dialed
+// outside the mutex, so a slow cluster does not block the consumer and the
+// routes meanwhile.
+func (s *KafkaServer) admin() (topicAdmin, error) {
+	s.mutex.Lock()
+	options := s.options
+	if options == nil || (options.admin == nil && len(options.Brokers) == 0) {
+		s.mutex.Unlock()
+		return nil, ErrAdminDisabled
+	}
+	if admin := options.admin; admin != nil {
+		s.mutex.Unlock()
+		return admin, nil
+	}
+	s.mutex.Unlock()
+
+	admin, err := newClusterAdmin(options)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// another caller connected first
+	if options.admin != nil {
+		admin.Close()
+		return options.admin, nil
+	}
+	options.admin = admin
+	return admin, nil
+}
+
+func (s *KafkaServer) closeAdmin() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.options == nil || s.options.admin == nil {
+		return
+	}
+	if err := s.options.admin.Close(); err != nil {
+		s.log.Printf("Error closing Kafka admin: %v", err)
+	}
+	s.options.admin = nil
+}
+
+// EnsureTopics creates the topics that do not exist yet. Existing topics are
+// left as they are, even when their layout differs.
+func (s *KafkaServer) EnsureTopics(topics ...TopicConfig) error {
+	admin, err := s.admin()
+	if err != nil {
+		return err
+	}
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		if _, ok := existing[topic.Name]; ok {
+			continue
+		}
+		err := admin.CreateTopic(topic.Name, topic.detail(), false)
+		// another instance may have created it in the meantime
+		if err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			return fmt.Errorf("create topic %s: %w", topic.Name, err)
+		}
+		if err == nil {
+			s.log.Printf("Created Kafka topic %s", topic.Name)
+		}
+	}
+	return nil
+}
+
+func (t TopicConfig) detail() *sarama.TopicDetail {
+	detail := &sarama.TopicDetail{
+		NumPartitions:     t.Partitions,
+		ReplicationFactor: t.ReplicationFactor,
+		ConfigEntries:     make(map[string]*string, len(t.Configs)+1),
+	}
+	if detail.NumPartitions <= 0 {
+		detail.NumPartitions = 1
+	}
+	if detail.ReplicationFactor <= 0 {
+		detail.ReplicationFactor = 1
+	}
+	for k, v := range t.Configs {
+		detail.ConfigEntries[k] = &v
+	}
+	if t.Retention > 0 {
+		retention := strconv.FormatInt(time.Duration(t.Retention).Milliseconds(), 10)
+		detail.ConfigEntries["retention.ms"] = &retention
+	}
+	return detail
+}
+
+// DescribeTopics returns the partitions and replication factor of topics.
+func (s *KafkaServer) DescribeTopics(topics ...string) ([]TopicDescription, error) {
+	admin, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := admin.DescribeTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]TopicDescription, 0, len(metadata))
+	for _, m := range metadata {
+		if !errors.Is(m.Err, sarama.ErrNoError) {
+			return nil, fmt.Errorf("describe topic %s: %w", m.Name, m.Err)
+		}
+		description := TopicDescription{Name: m.Name, Partitions: len(m.Partitions)}
+		if len(m.Partitions) > 0 {
+			description.ReplicationFactor = len(m.Partitions[0].Replicas)
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions, nil
+}
+
+// ConsumerGroupLag returns the lag of group on every partition of topics, the
+// consumed topics when none are given.
+func (s *KafkaServer) ConsumerGroupLag(group string, topics ...string) ([]PartitionLag, error) {
+	admin, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+	if len(topics) == 0 {
+		topics = s.topics
+	}
+
+	metadata, err := admin.DescribeTopics(topics)
+	if err != nil {
+		return nil, err
+	}
+	partitions := make(map[string][]int32, len(metadata))
+	for _, m := range metadata {
+		if !errors.Is(m.Err, sarama.ErrNoError) {
+			return nil, fmt.Errorf("describe topic %s: %w", m.Name, m.Err)
+		}
+		for _, p := range m.Partitions {
+			partitions[m.Name] = append(partitions[m.Name], p.ID)
+		}
+	}
+
+	offsets, err := admin.ListConsumerGroupOffsets(group, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	var lags []PartitionLag
+	for _, m := range metadata {
+		for _, partition := range partitions[m.Name] {
+			lag := PartitionLag{Topic: m.Name, Partition: partition, Committed: -1}
+			if block := offsets.GetBlock(m.Name, partition); block != nil {
+				lag.Committed = block.Offset
+			}
+
+			if lag.Latest, err = admin.GetOffset(m.Name, partition, sarama.OffsetNewest); err != nil {
+				return nil, err
+			}
+			from := lag.Committed
+			// without a commit the group starts at the oldest offset
+			if from < 0 {
+				if from, err = admin.GetOffset(m.Name, partition, sarama.OffsetOldest); err != nil {
+					return nil, err
+				}
+			}
+			lag.Lag = max(lag.Latest-from, 0)
+			lags = append(lags, lag)
+		}
+	}
+	return lags, nil
+}
+
+// DeleteTopics deletes topics, meant for tests. Topics that do not exist are
+// skipped.
+func (s *KafkaServer) DeleteTopics(topics ...string) error {
+	admin, err := s.admin()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, topic := range topics {
+		if err := admin.DeleteTopic(topic); err != nil && !errors.Is(err, sarama.ErrUnknownTopicOrPartition) {
+			errs = append(errs, fmt.Errorf("delete topic %s: %w", topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,211 @@
+package kp
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeAdmin struct {
+	topics  map[string]sarama.TopicDetail
+	created map[string]*sarama.TopicDetail
+	deleted []string
+	offsets map[string]map[int32]int64
+	newest  int64
+	oldest  int64
+	closed  bool
+}
+
+func newFakeAdmin(topics ...string) *fakeAdmin {
+	a := &fakeAdmin{
+		topics:  make(map[string]sarama.TopicDetail),
+		created: make(map[string]*sarama.TopicDetail),
+		offsets: make(map[string]map[int32]int64),
+	}
+	for _, topic := range topics {
+		a.topics[topic] = sarama.TopicDetail{NumPartitions: 2, ReplicationFactor: 3}
+	}
+	return a
+}
+
+func (a *fakeAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	return a.topics, nil
+}
+
+func (a *fakeAdmin) CreateTopic(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+	if _, ok := a.topics[topic]; ok {
+		return &sarama.TopicError{Err: sarama.ErrTopicAlreadyExists}
+	}
+	a.created[topic] = detail
+	a.topics[topic] = *detail
+	return nil
+}
+
+func (a *fakeAdmin) DescribeTopics(topics []string) ([]*sarama.TopicMetadata, error) {
+	var metadata []*sarama.TopicMetadata
+	for _, topic := range topics {
+		detail, ok := a.topics[topic]
+		if !ok {
+			metadata = append(metadata, &sarama.TopicMetadata{Name: topic, Err: sarama.ErrUnknownTopicOrPartition})
+			continue
+		}
+		m := &sarama.TopicMetadata{Name: topic}
+		for i := int32(0); i < detail.NumPartitions; i++ {
+			m.Partitions = append(m.Partitions, &sarama.PartitionMetadata{ID: i, Replicas: make([]int32, detail.ReplicationFactor)})
+		}
+		metadata = append(metadata, m)
+	}
+	return metadata, nil
+}
+
+func (a *fakeAdmin) DeleteTopic(topic string) error {
+	if _, ok := a.topics[topic]; !ok {
+		return sarama.ErrUnknownTopicOrPartition
+	}
+	delete(a.topics, topic)
+	a.deleted = append(a.deleted, topic)
+	return nil
+}
+
+func (a *fakeAdmin) ListConsumerGroupOffsets(group string, topicPartitions map[string][]int32) (*sarama.OffsetFetchResponse, error) {
+	response := &sarama.OffsetFetchResponse{}
+	for topic, partitions := range topicPartitions {
+		for _, partition := range partitions {
+			offset, ok := a.offsets[topic][partition]
+			if !ok {
+				offset = -1
+			}
+			response.AddBlock(topic, partition, &sarama.OffsetFetchResponseBlock{Offset: offset})
+		}
+	}
+	return response, nil
+}
+
+func (a *fakeAdmin) GetOffset(topic string, partition int32, time int64) (int64, error) {
+	if time == sarama.OffsetOldest {
+		return a.oldest, nil
+	}
+	return a.newest, nil
+}
+
+func (a *fakeAdmin) Close() error {
+	a.closed = true
+	return nil
+}
+
+func newAdminServer(admin *fakeAdmin) *KafkaServer {
+	return &KafkaServer{options: &KafkaConfig{admin: admin}, log: NewAppLogger(zap.NewNop())}
+}
+
+func TestEnsureTopicsCreatesMissingTopics(t *testing.T) {
+	admin := newFakeAdmin("orders")
+	server := newAdminServer(admin)
+
+	err := server.EnsureTopics(
+		TopicConfig{Name: "orders", Partitions: 6},
+		TopicConfig{Name: "book-log", Partitions: 3, ReplicationFactor: 2, Retention: Duration(24 * time.Hour), Configs: map[string]string{"cleanup.policy": "compact"}},
+		TopicConfig{Name: "audit"},
+	)
+
+	assert.NoError(t, err)
+	assert.NotContains(t, admin.created, "orders")
+	if detail := admin.created["book-log"]; assert.NotNil(t, detail) {
+		assert.Equal(t, int32(3), detail.NumPartitions)
+		assert.Equal(t, int16(2), detail.ReplicationFactor)
+		assert.Equal(t, "86400000", *detail.ConfigEntries["retention.ms"])
+		assert.Equal(t, "compact", *detail.ConfigEntries["cleanup.policy"])
+	}
+	if detail := admin.created["audit"]; assert.NotNil(t, detail) {
+		assert.Equal(t, int32(1), detail.NumPartitions)
+		assert.Equal(t, int16(1), detail.ReplicationFactor)
+		assert.Empty(t, detail.ConfigEntries)
+	}
+}
+
+func TestDescribeTopics(t *testing.T) {
+	server := newAdminServer(newFakeAdmin("orders"))
+
+	descriptions, err := server.DescribeTopics("orders")
+	assert.NoError(t, err)
+	assert.Equal(t, []TopicDescription{{Name: "orders", Partitions: 2, ReplicationFactor: 3}}, descriptions)
+
+	_, err = server.DescribeTopics("missing")
+	assert.ErrorIs(t, err, sarama.ErrUnknownTopicOrPartition)
+}
+
+func TestConsumerGroupLag(t *testing.T) {
+	admin := newFakeAdmin("orders")
+	admin.offsets["orders"] = map[int32]int64{0: 40}
+	admin.oldest = 10
+	admin.newest = 50
+	server := newAdminServer(admin)
+	server.topics = []string{"orders"}
+
+	lags, err := server.ConsumerGroupLag("my-group")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []PartitionLag{
+		{Topic: "orders", Partition: 0, Committed: 40, Latest: 50, Lag: 10},
+		{Topic: "orders", Partition: 1, Committed: -1, Latest: 50, Lag: 40},
+	}, lags)
+}
+
+func TestDeleteTopicsSkipsMissingTopics(t *testing.T) {
+	admin := newFakeAdmin("orders")
+	server := newAdminServer(admin)
+
+	assert.NoError(t, server.DeleteTopics("orders", "missing"))
+	assert.Equal(t, []string{"orders"}, admin.deleted)
+
+	server.Shutdown()
+	assert.True(t, admin.closed)
+	assert.Nil(t, server.options.admin)
+}
+
+func TestAdminDisabledWithoutBrokers(t *testing.T) {
+	server := &KafkaServer{options: &KafkaConfig{}}
+
+	assert.True(t, errors.Is(server.EnsureTopics(TopicConfig{Name: "orders"}), ErrAdminDisabled))
+	_, err := server.DescribeTopics("orders")
+	assert.ErrorIs(t, err, ErrAdminDisabled)
+}
+
+func TestAdminDialsOutsideMutex(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	server := &KafkaServer{options: &KafkaConfig{Brokers: []string{listener.Addr().String()}, GroupID: "library"}}
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.admin()
+		done <- err
+	}()
+
+	select {
+	case conn := <-accepted:
+		// the broker is being dialed, the server mutex must be free
+		if assert.True(t, server.mutex.TryLock()) {
+			server.mutex.Unlock()
+		}
+		listener.Close()
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the broker was not dialed")
+	}
+
+	assert.Error(t, <-done)
+	assert.Nil(t, server.options.admin)
+}
@@ -0,0 +1,222 @@
+package kp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/IBM/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// TLSConfig enables TLS to the brokers. CAFile replaces the system roots,
+// CertFile and KeyFile add a client certificate.
+type TLSConfig struct {
+	Enabled            bool   `json:"enabled" validate:"required_with=CAFile CertFile KeyFile"`
+	CAFile             string `json:"caFile"`
+	CertFile           string `json:"certFile" validate:"required_with=KeyFile"`
+	KeyFile            string `json:"keyFile" validate:"required_with=CertFile"`
+	ServerName         string `json:"serverName"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// fieldErrors checks the settings that depend on each other, the rest is
+// covered by the validate tags.
+func (c *KafkaConfig) fieldErrors() []FieldError {
+	var fields []FieldError
+
+	version := sarama.V2_5_0_0
+	if c.Version != "" {
+		v, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return append(fields, FieldError{
+				Field:   "kafka.version",
+				Tag:     "version",
+				Message: fmt.Sprintf("kafka.version %q is not a valid Kafka version", c.Version),
+			})
+		}
+		version = v
+	}
+
+	if c.Idempotent {
+		if c.RequiredAcks != "" && c.RequiredAcks != "all" {
+			fields = append(fields, FieldError{
+				Field:   "kafka.requiredAcks",
+				Tag:     "idempotent",
+				Message: "kafka.requiredAcks must be all when kafka.idempotent is set",
+			})
+		}
+		if !version.IsAtLeast(sarama.V0_11_0_0) {
+			fields = append(fields, FieldError{
+				Field:   "kafka.version",
+				Tag:     "idempotent",
+				Message: "kafka.version must be at least 0.11.0 when kafka.idempotent is set",
+			})
+		}
+	}
+
+	if c.Compression == "zstd" && !version.IsAtLeast(sarama.V2_1_0_0) {
+		fields = append(fields, FieldError{
+			Field:   "kafka.version",
+			Tag:     "compression",
+			Message: "kafka.version must be at least 2.1.0 when kafka.compression is zstd",
+		})
+	}
+	return fields
+}
+
+// validate runs the validate tags and fieldErrors, for a KafkaConfig that
+// was built in code rather than read by LoadConfig.
+func (c *KafkaConfig) validate() error {
+	var fields []FieldError
+	if err := Validate(c); err != nil {
+		ve, ok := err.(*ValidationError)
+		if !ok {
+			return err
+		}
+		for _, field := range ve.Fields {
+			field.Field = "kafka." + field.Field
+			field.Message = "kafka." + field.Message
+			fields = append(fields, field)
+		}
+	}
+	fields = append(fields, c.fieldErrors()...)
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// saramaConfig is the client config shared by the producers and the
+// consumer.
+func (c *KafkaConfig) saramaConfig() (*sarama.Config, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_5_0_0
+	if c.Version != "" {
+		config.Version, _ = sarama.ParseKafkaVersion(c.Version)
+	}
+	if c.ClientID != "" {
+		config.ClientID = c.ClientID
+	}
+
+	if c.Username != "" && c.Password != "" {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = c.Username
+		config.Net.SASL.Password = c.Password
+		switch c.SASLMechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA256} }
+		case sarama.SASLTypeSCRAMSHA512:
+			config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+			config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scram.SHA512} }
+		case "", sarama.SASLTypePlaintext:
+			config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		default:
+			return nil, fmt.Errorf("kafka: unsupported SASL mechanism %q", c.SASLMechanism)
+		}
+	}
+
+	if c.TLS.Enabled {
+		tlsConfig, err := c.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	switch c.Compression {
+	case "gzip":
+		config.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		config.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		config.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		config.Producer.Compression = sarama.CompressionZSTD
+	}
+
+	switch c.RequiredAcks {
+	case "none":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	case "leader":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case "all":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	}
+
+	if c.Idempotent {
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+
+	switch c.RebalanceStrategy {
+	case "roundrobin":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRoundRobin()}
+	case "sticky":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
+	default:
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategyRange()}
+	}
+
+	return config, nil
+}
+
+func (c TLSConfig) load() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka tls: no certificate found in %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("kafka tls: load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// scramClient is the sarama.SCRAMClient of SCRAM-SHA-256 and SCRAM-SHA-512.
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hash.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
@@ -0,0 +1,123 @@
+package kp
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaramaConfigDefaults(t *testing.T) {
+	config, err := (&KafkaConfig{}).saramaConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, sarama.V2_5_0_0, config.Version)
+	assert.False(t, config.Net.SASL.Enable)
+	assert.False(t, config.Net.TLS.Enable)
+	assert.Equal(t, sarama.WaitForLocal, config.Producer.RequiredAcks)
+	if assert.Len(t, config.Consumer.Group.Rebalance.GroupStrategies, 1) {
+		assert.Equal(t, sarama.RangeBalanceStrategyName, config.Consumer.Group.Rebalance.GroupStrategies[0].Name())
+	}
+}
+
+func TestSaramaConfig(t *testing.T) {
+	config, err := (&KafkaConfig{
+		ClientID:          "library",
+		Version:           "3.6.0",
+		Username:          "user",
+		Password:          "secret",
+		SASLMechanism:     sarama.SASLTypeSCRAMSHA512,
+		Compression:       "zstd",
+		Idempotent:        true,
+		RebalanceStrategy: "sticky",
+	}).saramaConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "library", config.ClientID)
+	assert.Equal(t, sarama.V3_6_0_0, config.Version)
+	assert.True(t, config.Net.SASL.Enable)
+	assert.Equal(t, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512), config.Net.SASL.Mechanism)
+	if assert.NotNil(t, config.Net.SASL.SCRAMClientGeneratorFunc) {
+		client := config.Net.SASL.SCRAMClientGeneratorFunc()
+		assert.NoError(t, client.Begin("user", "secret", ""))
+		first, err := client.Step("")
+		assert.NoError(t, err)
+		assert.Contains(t, first, "n=user")
+	}
+	assert.Equal(t, sarama.CompressionZSTD, config.Producer.Compression)
+	assert.True(t, config.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, config.Producer.RequiredAcks)
+	assert.Equal(t, sarama.StickyBalanceStrategyName, config.Consumer.Group.Rebalance.GroupStrategies[0].Name())
+	assert.NoError(t, config.Validate())
+}
+
+func TestSaramaConfigRejectsInvalidSettings(t *testing.T) {
+	_, err := (&KafkaConfig{Compression: "zstd", Version: "2.0.0"}).saramaConfig()
+	assert.EqualError(t, err, "validation failed: kafka.version must be at least 2.1.0 when kafka.compression is zstd")
+
+	_, err = (&KafkaConfig{TLS: TLSConfig{Enabled: true, CAFile: filepath.Join(t.TempDir(), "ca.pem")}}).saramaConfig()
+	assert.ErrorContains(t, err, "kafka tls: read CA file")
+
+	_, err = (&KafkaConfig{TLS: TLSConfig{Enabled: true, CAFile: writeConfigFile(t, "ca.pem", "not a certificate")}}).saramaConfig()
+	assert.ErrorContains(t, err, "no certificate found")
+}
+
+func TestSaramaConfigTLS(t *testing.T) {
+	config, err := (&KafkaConfig{TLS: TLSConfig{Enabled: true, ServerName: "kafka.internal"}}).saramaConfig()
+
+	assert.NoError(t, err)
+	assert.True(t, config.Net.TLS.Enable)
+	assert.Equal(t, "kafka.internal", config.Net.TLS.Config.ServerName)
+	assert.Nil(t, config.Net.TLS.Config.RootCAs)
+}
+
+func TestSaramaConfigValidatesTags(t *testing.T) {
+	cases := map[string]struct {
+		config KafkaConfig
+		field  string
+	}{
+		"unknown SASL mechanism": {
+			config: KafkaConfig{Username: "user", Password: "secret", SASLMechanism: "GSSAPI"},
+			field:  "kafka.saslMechanism",
+		},
+		"SASL mechanism without credentials": {
+			config: KafkaConfig{SASLMechanism: sarama.SASLTypeSCRAMSHA512},
+			field:  "kafka.username",
+		},
+		"username without password": {
+			config: KafkaConfig{Username: "user", SASLMechanism: sarama.SASLTypeSCRAMSHA512},
+			field:  "kafka.password",
+		},
+		"CA file without TLS": {
+			config: KafkaConfig{TLS: TLSConfig{CAFile: "ca.pem"}},
+			field:  "kafka.tls.enabled",
+		},
+		"unknown compression": {
+			config: KafkaConfig{Compression: "brotli"},
+			field:  "kafka.compression",
+		},
+		"unknown rebalance strategy": {
+			config: KafkaConfig{RebalanceStrategy: "cooperative"},
+			field:  "kafka.rebalanceStrategy",
+		},
+		"unknown required acks": {
+			config: KafkaConfig{RequiredAcks: "two"},
+			field:  "kafka.requiredAcks",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.config.saramaConfig()
+
+			var ve *ValidationError
+			if assert.ErrorAs(t, err, &ve) {
+				var fields []string
+				for _, f := range ve.Fields {
+					fields = append(fields, f.Field)
+				}
+				assert.Contains(t, fields, tc.field)
+			}
+		})
+	}
+}
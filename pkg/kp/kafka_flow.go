@@ -0,0 +1,351 @@
+package kp
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"golang.org/x/time/rate"
+)
+
+// ErrCircuitOpen tells the consumer that a dependency of the handler is down.
+// With ConsumerOptions.CircuitPause a handler error wrapping it pauses the
+// topic instead of failing the message.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// TopicState is the flow control of a consumed topic.
+type TopicState struct {
+	Topic     string  `json:"topic"`
+	Paused    bool    `json:"paused"`
+	Circuit   bool    `json:"circuitOpen,omitempty"`
+	RateLimit float64 `json:"rateLimit,omitempty"`
+	Burst     int     `json:"burst,omitempty"`
+}
+
+// flowControl holds the paused topics and the rate limiters. A topic paused
+// with Pause and a topic whose circuit is open have a channel that Resume,
+// or for a circuit the end of its pause, closes. The partitions of a topic
+// stay paused while either holds.
+type flowControl struct {
+	mu       sync.Mutex
+	claims   map[string][]int32
+	paused   map[string]chan struct{}
+	circuits map[string]chan struct{}
+	limiters map[string]*rate.Limiter
+}
+
+// Pause stops fetching the messages of topic until Resume, also after a
+// rebalance. Messages already fetched are still handled.
+func (s *KafkaServer) Pause(topic string) {
+	client := s.consumerGroup()
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	if _, ok := s.flow.paused[topic]; ok {
+		return
+	}
+	if s.flow.paused == nil {
+		s.flow.paused = make(map[string]chan struct{})
+	}
+	s.flow.paused[topic] = make(chan struct{})
+	if _, open := s.flow.circuits[topic]; !open {
+		s.pausePartitions(client, topic)
+	}
+	s.log.Printf("Paused Kafka topic %s", topic)
+}
+
+// Resume fetches the messages of a paused topic again, also of a topic whose
+// circuit is open.
+func (s *KafkaServer) Resume(topic string) {
+	client := s.consumerGroup()
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	paused, manual := s.flow.paused[topic]
+	circuit, open := s.flow.circuits[topic]
+	if !manual && !open {
+		return
+	}
+	if manual {
+		delete(s.flow.paused, topic)
+		close(paused)
+	}
+	if open {
+		delete(s.flow.circuits, topic)
+		close(circuit)
+	}
+	s.resumePartitions(client, topic)
+	s.log.Printf("Resumed Kafka topic %s", topic)
+}
+
+// openCircuit pauses topic for its handler, apart from a pause of Pause.
+func (s *KafkaServer) openCircuit(topic string) <-chan struct{} {
+	client := s.consumerGroup()
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	if circuit, ok := s.flow.circuits[topic]; ok {
+		return circuit
+	}
+	if s.flow.circuits == nil {
+		s.flow.circuits = make(map[string]chan struct{})
+	}
+	circuit := make(chan struct{})
+	s.flow.circuits[topic] = circuit
+	if _, manual := s.flow.paused[topic]; !manual {
+		s.pausePartitions(client, topic)
+	}
+	s.log.Printf("Circuit open, paused Kafka topic %s", topic)
+	return circuit
+}
+
+// closeCircuit ends the circuit pause of topic. The topic stays paused when
+// Pause paused it too.
+func (s *KafkaServer) closeCircuit(topic string) {
+	client := s.consumerGroup()
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	circuit, ok := s.flow.circuits[topic]
+	if !ok {
+		return
+	}
+	delete(s.flow.circuits, topic)
+	close(circuit)
+	if _, manual := s.flow.paused[topic]; !manual {
+		s.resumePartitions(client, topic)
+		s.log.Printf("Circuit closed, resumed Kafka topic %s", topic)
+	}
+}
+
+// pausePartitions and resumePartitions need s.flow.mu. The client is taken
+// before it, s.mutex is never locked under s.flow.mu.
+func (s *KafkaServer) pausePartitions(client sarama.ConsumerGroup, topic string) {
+	if partitions := s.flow.claims[topic]; len(partitions) > 0 && client != nil {
+		client.Pause(map[string][]int32{topic: partitions})
+	}
+}
+
+func (s *KafkaServer) resumePartitions(client sarama.ConsumerGroup, topic string) {
+	if partitions := s.flow.claims[topic]; len(partitions) > 0 && client != nil {
+		client.Resume(map[string][]int32{topic: partitions})
+	}
+}
+
+// SetRateLimit limits the messages of topic handled per second by this
+// instance, with bursts of up to burst messages. A limit of 0 removes it,
+// also the one of ConsumerOptions.RateLimit.
+func (s *KafkaServer) SetRateLimit(topic string, perSecond float64, burst int) {
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	if s.flow.limiters == nil {
+		s.flow.limiters = make(map[string]*rate.Limiter)
+	}
+	s.flow.limiters[topic] = newLimiter(perSecond, burst)
+}
+
+// TopicStates returns the flow control of the subscribed topics and of the
+// topics paused or limited at runtime, sorted by topic.
+func (s *KafkaServer) TopicStates() []TopicState {
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	topics := make(map[string]bool)
+	for _, topic := range s.topics {
+		topics[topic] = true
+	}
+	for topic := range s.flow.claims {
+		topics[topic] = true
+	}
+	for topic := range s.flow.paused {
+		topics[topic] = true
+	}
+	for topic := range s.flow.circuits {
+		topics[topic] = true
+	}
+	for topic := range s.flow.limiters {
+		topics[topic] = true
+	}
+
+	states := make([]TopicState, 0, len(topics))
+	for topic := range topics {
+		state := TopicState{Topic: topic}
+		_, state.Paused = s.flow.paused[topic]
+		_, state.Circuit = s.flow.circuits[topic]
+		state.Paused = state.Paused || state.Circuit
+		if limiter := s.flow.limiters[topic]; limiter != nil {
+			state.RateLimit = float64(limiter.Limit())
+			state.Burst = limiter.Burst()
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Topic < states[j].Topic })
+	return states
+}
+
+func newLimiter(perSecond float64, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(perSecond))
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// limiter returns the rate limiter of topic, created from the options of its
+// route on first use. nil means no limit.
+func (s *KafkaServer) limiter(topic string, route consumerRoute) *rate.Limiter {
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	if limiter, ok := s.flow.limiters[topic]; ok {
+		return limiter
+	}
+	if s.flow.limiters == nil {
+		s.flow.limiters = make(map[string]*rate.Limiter)
+	}
+	limiter := newLimiter(route.options.RateLimit, route.options.RateBurst)
+	s.flow.limiters[topic] = limiter
+	return limiter
+}
+
+// waitRate blocks until the rate limit of the topic lets the message through.
+func (s *KafkaServer) waitRate(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, route consumerRoute) error {
+	limiter := s.limiter(message.Topic, route)
+	if limiter == nil {
+		return nil
+	}
+	return limiter.Wait(session.Context())
+}
+
+// pauseFor pauses topic after its handler reported ErrCircuitOpen and
+// resumes it after d, or sooner through Resume. A pause of Pause outlives the
+// circuit, the message waits for its Resume. It returns false when the
+// session ends first.
+func (s *KafkaServer) pauseFor(session sarama.ConsumerGroupSession, topic string, d time.Duration) bool {
+	closed := s.openCircuit(topic)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		s.closeCircuit(topic)
+	case <-closed:
+	case <-session.Context().Done():
+		// the partitions are revoked, the next session retries the message
+		s.closeCircuit(topic)
+		return false
+	}
+
+	s.flow.mu.Lock()
+	paused := s.flow.paused[topic]
+	s.flow.mu.Unlock()
+	if paused == nil {
+		return true
+	}
+	select {
+	case <-paused:
+		return true
+	case <-session.Context().Done():
+		return false
+	}
+}
+
+// trackClaims remembers the partitions of the session, Pause needs them.
+func (s *KafkaServer) trackClaims(claims map[string][]int32) {
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+	s.flow.claims = claims
+}
+
+// pauseClaim pauses a new claim of a paused topic, the partition consumers of
+// a rebalance start unpaused.
+func (s *KafkaServer) pauseClaim(claim sarama.ConsumerGroupClaim) {
+	client := s.consumerGroup()
+	s.flow.mu.Lock()
+	defer s.flow.mu.Unlock()
+
+	_, manual := s.flow.paused[claim.Topic()]
+	_, open := s.flow.circuits[claim.Topic()]
+	if (manual || open) && client != nil {
+		client.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	}
+}
+
+type rateLimitInput struct {
+	PerSecond float64 `json:"perSecond" validate:"min=0"`
+	Burst     int     `json:"burst" validate:"min=0"`
+}
+
+// UseKafkaAdmin mounts the flow control endpoints of the consumer under
+// /admin/kafka. They change what the instance consumes, protect them with the
+// middlewares (e.g. auth). Without an HTTP router, i.e. no app.port, they
+// are not mounted.
+//
+//	GET  /admin/kafka/topics
+//	POST /admin/kafka/topics/:topic/pause
+//	POST /admin/kafka/topics/:topic/resume
+//	PUT  /admin/kafka/topics/:topic/rate-limit {"perSecond": 10, "burst": 20}
+func (s *Server) UseKafkaAdmin(middlewares ...Middleware) {
+	if s.router == nil {
+		s.Log.Println("Kafka admin endpoints not mounted: no HTTP router, set app.port")
+		return
+	}
+	g := s.Group("/admin/kafka", middlewares...)
+	g.Get("/topics", s.kafkaTopics)
+	g.Post("/topics/:topic/pause", s.pauseTopic)
+	g.Post("/topics/:topic/resume", s.resumeTopic)
+	g.Put("/topics/:topic/rate-limit", s.setTopicRateLimit)
+}
+
+func (s *Server) kafkaTopics(ctx IContext) error {
+	return ctx.Response(http.StatusOK, s.kafka.TopicStates())
+}
+
+func (s *Server) pauseTopic(ctx IContext) error {
+	topic := ctx.Param("topic")
+	if _, _, ok := s.kafka.route(topic); !ok {
+		return NotFound("topic is not consumed")
+	}
+	s.kafka.Pause(topic)
+	return ctx.Response(http.StatusOK, s.kafka.topicState(topic))
+}
+
+func (s *Server) resumeTopic(ctx IContext) error {
+	topic := ctx.Param("topic")
+	if _, _, ok := s.kafka.route(topic); !ok {
+		return NotFound("topic is not consumed")
+	}
+	s.kafka.Resume(topic)
+	return ctx.Response(http.StatusOK, s.kafka.topicState(topic))
+}
+
+func (s *Server) setTopicRateLimit(ctx IContext) error {
+	topic := ctx.Param("topic")
+	if _, _, ok := s.kafka.route(topic); !ok {
+		return NotFound("topic is not consumed")
+	}
+
+	var input rateLimitInput
+	if err := ctx.ReadInput(&input); err != nil {
+		return InvalidInput(err)
+	}
+	s.kafka.SetRateLimit(topic, input.PerSecond, input.Burst)
+	return ctx.Response(http.StatusOK, s.kafka.topicState(topic))
+}
+
+func (s *KafkaServer) topicState(topic string) TopicState {
+	for _, state := range s.TopicStates() {
+		if state.Topic == topic {
+			return state
+		}
+	}
+	return TopicState{Topic: topic}
+}
@@ -0,0 +1,165 @@
+package kp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPauseResumeClaimedPartitions(t *testing.T) {
+	client := &MockConsumerGroup{}
+	client.On("Pause", map[string][]int32{"orders": {0, 1}})
+	client.On("Resume", map[string][]int32{"orders": {0, 1}})
+	server := &KafkaServer{client: client, log: NewAppLogger(zap.NewNop())}
+	server.Consume("orders", func(ctx IContext) error { return nil })
+
+	session := new(MockConsumerGroupSession)
+	session.On("Claims").Return(map[string][]int32{"orders": {0, 1}})
+	assert.NoError(t, server.Setup(session))
+
+	server.Pause("orders")
+	server.Pause("orders")
+	assert.Equal(t, []TopicState{{Topic: "orders", Paused: true}}, server.TopicStates())
+
+	server.Resume("orders")
+	assert.Equal(t, []TopicState{{Topic: "orders"}}, server.TopicStates())
+	client.AssertNumberOfCalls(t, "Pause", 1)
+	client.AssertNumberOfCalls(t, "Resume", 1)
+}
+
+func TestConsumeClaimPausesNewClaimOfPausedTopic(t *testing.T) {
+	client := &MockConsumerGroup{}
+	client.On("Pause", map[string][]int32{"orders": {3}})
+	server := &KafkaServer{client: client, log: NewAppLogger(zap.NewNop())}
+	server.Consume("orders", func(ctx IContext) error { return nil })
+	server.Pause("orders")
+
+	session := new(MockConsumerGroupSession)
+	channel := make(chan *sarama.ConsumerMessage)
+	close(channel)
+	claim := new(MockConsumerGroupClaim)
+	claim.On("Topic").Return("orders")
+	claim.On("Partition").Return(int32(3))
+	claim.On("Messages").Return(channel)
+
+	assert.NoError(t, server.ConsumeClaim(session, claim))
+	client.AssertCalled(t, "Pause", map[string][]int32{"orders": {3}})
+}
+
+func TestConsumeClaimRateLimit(t *testing.T) {
+	server := &KafkaServer{log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("orders", ConsumerOptions{RateLimit: 20, RateBurst: 1}, func(ctx IContext) error { return nil })
+
+	start := time.Now()
+	_, err := consumeMessages(server,
+		&sarama.ConsumerMessage{Topic: "orders", Offset: 0, Value: []byte(`{}`)},
+		&sarama.ConsumerMessage{Topic: "orders", Offset: 1, Value: []byte(`{}`)},
+		&sarama.ConsumerMessage{Topic: "orders", Offset: 2, Value: []byte(`{}`)},
+	)
+
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+	assert.Equal(t, []TopicState{{Topic: "orders", RateLimit: 20, Burst: 1}}, server.TopicStates())
+
+	server.SetRateLimit("orders", 0, 0)
+	assert.Equal(t, []TopicState{{Topic: "orders"}}, server.TopicStates())
+}
+
+func TestConsumeClaimPausesOnCircuitOpen(t *testing.T) {
+	calls := 0
+	server := &KafkaServer{log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("orders", ConsumerOptions{CircuitPause: 20 * time.Millisecond}, func(ctx IContext) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("payment service: %w", ErrCircuitOpen)
+		}
+		return nil
+	})
+
+	start := time.Now()
+	session, err := consumeMessages(server, &sarama.ConsumerMessage{Topic: "orders", Value: []byte(`{}`)})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	session.AssertNumberOfCalls(t, "MarkMessage", 1)
+	assert.False(t, server.TopicStates()[0].Paused)
+}
+
+func TestCircuitPauseKeepsManualPause(t *testing.T) {
+	var calls atomic.Int32
+	server := &KafkaServer{log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("orders", ConsumerOptions{CircuitPause: 10 * time.Millisecond}, func(ctx IContext) error {
+		if calls.Add(1) == 1 {
+			return fmt.Errorf("payment service: %w", ErrCircuitOpen)
+		}
+		return nil
+	})
+	server.Pause("orders")
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := consumeMessages(server, &sarama.ConsumerMessage{Topic: "orders", Value: []byte(`{}`)})
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load(), "the circuit lifted the operator pause")
+	assert.Equal(t, []TopicState{{Topic: "orders", Paused: true}}, server.TopicStates())
+
+	server.Resume("orders")
+	assert.NoError(t, <-done)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestKafkaAdminEndpoints(t *testing.T) {
+	app := newBackendApplication(Gin)
+	app.Consume("orders", func(ctx IContext) error { return nil })
+	app.UseKafkaAdmin()
+
+	send := func(method, path, body string) (int, string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	code, body := send(http.MethodPost, "/admin/kafka/topics/orders/pause", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"topic":"orders","paused":true}`, body)
+
+	code, body = send(http.MethodPut, "/admin/kafka/topics/orders/rate-limit", `{"perSecond":5,"burst":10}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"topic":"orders","paused":true,"rateLimit":5,"burst":10}`, body)
+
+	code, _ = send(http.MethodPut, "/admin/kafka/topics/orders/rate-limit", `{"perSecond":-1}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = send(http.MethodPost, "/admin/kafka/topics/payments/pause", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, body = send(http.MethodPost, "/admin/kafka/topics/orders/resume", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body = send(http.MethodGet, "/admin/kafka/topics", "")
+	assert.Equal(t, http.StatusOK, code)
+	var states []TopicState
+	assert.NoError(t, json.Unmarshal([]byte(body), &states))
+	assert.Equal(t, []TopicState{{Topic: "orders", RateLimit: 5, Burst: 10}}, states)
+}
+
+func TestKafkaAdminWithoutRouter(t *testing.T) {
+	app := &Server{kafka: &KafkaServer{options: &KafkaConfig{}, log: NewMockLogger()}, Log: NewMockLogger()}
+
+	assert.NotPanics(t, func() { app.UseKafkaAdmin() })
+}
@@ -0,0 +1,177 @@
+package kp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultTopicRefreshInterval = time.Minute
+
+// subscriptionRetryDelay is the first wait after a failed topic listing, it
+// doubles up to maxSubscriptionRetryDelay.
+var (
+	subscriptionRetryDelay    = time.Second
+	maxSubscriptionRetryDelay = 30 * time.Second
+)
+
+// topicPattern is a subscription to every topic a pattern matches.
+type topicPattern struct {
+	pattern string
+	match   func(topic string) bool
+	handler ServiceHandleFunc
+	route   consumerRoute
+}
+
+// ConsumePattern registers the handler of every topic matching a glob
+// pattern, e.g. "orders.*", see path.Match for the syntax. Retry topics in
+// opts are subscribed by name, like with ConsumeWithOptions.
+//
+// A topic with a handler registered by name always goes to that handler.
+// Otherwise it goes to the first registered pattern that matches it. Patterns
+// never match internal topics (__*) or the dead-letter topic of a route.
+func (s *KafkaServer) ConsumePattern(pattern string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("topic pattern %q: %w", pattern, err)
+	}
+	s.addPattern(pattern, func(topic string) bool {
+		ok, _ := path.Match(pattern, topic)
+		return ok
+	}, opts, handler, middlewares)
+	return nil
+}
+
+// ConsumeRegexp is ConsumePattern with a regular expression that must match
+// the whole topic name.
+func (s *KafkaServer) ConsumeRegexp(expr string, opts ConsumerOptions, handler ServiceHandleFunc, middlewares ...Middleware) error {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return fmt.Errorf("topic regexp %q: %w", expr, err)
+	}
+	s.addPattern(expr, re.MatchString, opts, handler, middlewares)
+	return nil
+}
+
+func (s *KafkaServer) addPattern(pattern string, match func(string) bool, opts ConsumerOptions, handler ServiceHandleFunc, middlewares []Middleware) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	handler = s.addRoutes("", opts, handler, middlewares)
+
+	next := opts.DeadLetterTopic
+	if len(opts.RetryTopics) > 0 {
+		next = opts.RetryTopics[0]
+	}
+	s.patterns = append(s.patterns, topicPattern{
+		pattern: pattern,
+		match:   match,
+		handler: handler,
+		// without an origin the codec comes from the consumed topic
+		route: consumerRoute{options: opts, next: next},
+	})
+}
+
+// route finds the handler of a topic, see ConsumePattern for the order.
+func (s *KafkaServer) route(topic string) (ServiceHandleFunc, consumerRoute, bool) {
+	if handler, ok := s.handlers[topic]; ok {
+		return handler, s.routes[topic], true
+	}
+	if strings.HasPrefix(topic, "__") || s.deadLetters[topic] {
+		return nil, consumerRoute{}, false
+	}
+	for _, p := range s.patterns {
+		if p.match(topic) {
+			return p.handler, p.route, true
+		}
+	}
+	return nil, consumerRoute{}, false
+}
+
+// subscription is the list of topics to consume: the topics registered by
+// name, then the existing topics matching a pattern in name order.
+func (s *KafkaServer) subscription() ([]string, error) {
+	s.mutex.Lock()
+	topics := slices.Clone(s.topics)
+	patterns := len(s.patterns)
+	s.mutex.Unlock()
+
+	if patterns == 0 {
+		return topics, nil
+	}
+
+	admin, err := s.admin()
+	if err != nil {
+		return nil, err
+	}
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]string, 0, len(existing))
+	for topic := range existing {
+		if _, ok := s.handlers[topic]; ok {
+			continue
+		}
+		if _, _, ok := s.route(topic); ok {
+			matched = append(matched, topic)
+		}
+	}
+	sort.Strings(matched)
+	return append(topics, matched...), nil
+}
+
+// waitSubscription retries subscription until it succeeds, a failing topic
+// listing must not stop the consumer for good. It returns false when ctx is
+// done first.
+func (s *KafkaServer) waitSubscription(ctx context.Context) ([]string, bool) {
+	delay := subscriptionRetryDelay
+	for {
+		topics, err := s.subscription()
+		if err == nil {
+			return topics, true
+		}
+		s.log.Printf("Failed to list Kafka topics, retrying in %s: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxSubscriptionRetryDelay)
+	}
+}
+
+// watchTopics ends the session with cancel once the topics matching the
+// patterns differ from topics.
+func (s *KafkaServer) watchTopics(ctx context.Context, topics []string, cancel context.CancelFunc) {
+	interval := defaultTopicRefreshInterval
+	if s.options != nil && s.options.TopicRefreshInterval > 0 {
+		interval = time.Duration(s.options.TopicRefreshInterval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current, err := s.subscription()
+			if err != nil {
+				s.log.Printf("Failed to refresh Kafka topics: %v", err)
+				continue
+			}
+			if !slices.Equal(current, topics) {
+				s.log.Printf("Kafka topics changed, restarting the consumer with %v", current)
+				cancel()
+				return
+			}
+		}
+	}
+}
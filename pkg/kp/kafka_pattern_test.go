@@ -0,0 +1,187 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func handlerNamed(name string, calls *[]string) ServiceHandleFunc {
+	return func(ctx IContext) error {
+		*calls = append(*calls, name)
+		return nil
+	}
+}
+
+func TestRouteOrder(t *testing.T) {
+	var calls []string
+	server := &KafkaServer{log: NewAppLogger(zap.NewNop())}
+	server.Consume("orders.created", handlerNamed("exact", &calls))
+	assert.NoError(t, server.ConsumePattern("orders.*", ConsumerOptions{DeadLetterTopic: "orders.dlt"}, handlerNamed("glob", &calls)))
+	assert.NoError(t, server.ConsumeRegexp(`orders\.(paid|shipped)`, ConsumerOptions{}, handlerNamed("regexp", &calls)))
+	assert.NoError(t, server.ConsumeRegexp(`payments\.\d+`, ConsumerOptions{}, handlerNamed("payments", &calls)))
+
+	for _, topic := range []string{"orders.created", "orders.paid", "payments.42", "orders.dlt", "payments.42.dlt", "__consumer_offsets"} {
+		if handler, _, ok := server.route(topic); ok {
+			handler(nil)
+		} else {
+			calls = append(calls, "none")
+		}
+	}
+
+	assert.Equal(t, []string{"exact", "glob", "payments", "none", "none", "none"}, calls)
+}
+
+func TestConsumePatternInvalid(t *testing.T) {
+	server := &KafkaServer{}
+
+	assert.Error(t, server.ConsumePattern("orders.[", ConsumerOptions{}, nil))
+	assert.Error(t, server.ConsumeRegexp("orders.(", ConsumerOptions{}, nil))
+	assert.Empty(t, server.patterns)
+}
+
+func TestConsumePatternRetryTopics(t *testing.T) {
+	var forwarded *sarama.ProducerMessage
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		forwarded = msg
+		return nil
+	})
+	server := &KafkaServer{producer: producer, log: NewMockLogger()}
+	assert.NoError(t, server.ConsumePattern("orders.*", ConsumerOptions{RetryTopics: []string{"retry.orders"}, DeadLetterTopic: "dlt.orders"}, func(ctx IContext) error {
+		return errors.New("boom")
+	}))
+
+	_, err := consumeMessages(server, &sarama.ConsumerMessage{Topic: "orders.created", Value: []byte(`{}`)})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"retry.orders"}, server.topics)
+	assert.Equal(t, "dlt.orders", server.routes["retry.orders"].next)
+	if assert.NotNil(t, forwarded) {
+		assert.Equal(t, "retry.orders", forwarded.Topic)
+		assert.Equal(t, "orders.created", headerMap(forwarded.Headers)[HeaderOriginTopic])
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	server := newAdminServer(newFakeAdmin("orders.paid", "orders.created", "orders.dlt", "payments", "__consumer_offsets"))
+	server.Consume("payments", nil)
+	assert.NoError(t, server.ConsumePattern("orders.*", ConsumerOptions{DeadLetterTopic: "orders.dlt"}, nil))
+
+	topics, err := server.subscription()
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"payments", "orders.created", "orders.paid"}, topics)
+}
+
+// growingAdmin is a fakeAdmin whose topics can be added while the consumer
+// runs.
+type growingAdmin struct {
+	*fakeAdmin
+	mu sync.Mutex
+}
+
+func (a *growingAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	topics := make(map[string]sarama.TopicDetail, len(a.topics))
+	for k, v := range a.topics {
+		topics[k] = v
+	}
+	return topics, nil
+}
+
+func (a *growingAdmin) add(topic string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.topics[topic] = sarama.TopicDetail{NumPartitions: 1}
+}
+
+// sessionConsumerGroup records the topics of every session and blocks until
+// the session ends.
+type sessionConsumerGroup struct {
+	MockConsumerGroup
+	sessions chan []string
+}
+
+func (c *sessionConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	c.sessions <- topics
+	<-ctx.Done()
+	return nil
+}
+
+func TestStartConsumerPicksUpNewTopics(t *testing.T) {
+	admin := &growingAdmin{fakeAdmin: newFakeAdmin("orders.created")}
+	client := &sessionConsumerGroup{sessions: make(chan []string, 4)}
+	server := &KafkaServer{
+		client:  client,
+		options: &KafkaConfig{admin: admin, TopicRefreshInterval: Duration(10 * time.Millisecond)},
+		log:     NewAppLogger(zap.NewNop()),
+	}
+	assert.NoError(t, server.ConsumePattern("orders.*", ConsumerOptions{}, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.StartConsumer(ctx) }()
+
+	assert.Equal(t, []string{"orders.created"}, <-client.sessions)
+	admin.add("orders.paid")
+	assert.Equal(t, []string{"orders.created", "orders.paid"}, <-client.sessions)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+// flakyAdmin fails the first listings of the topics.
+type flakyAdmin struct {
+	*growingAdmin
+	failures int
+}
+
+func (a *flakyAdmin) ListTopics() (map[string]sarama.TopicDetail, error) {
+	a.mu.Lock()
+	if a.failures > 0 {
+		a.failures--
+		a.mu.Unlock()
+		return nil, errors.New("broker not available")
+	}
+	a.mu.Unlock()
+	return a.growingAdmin.ListTopics()
+}
+
+func TestStartConsumerRetriesTopicListing(t *testing.T) {
+	prev := subscriptionRetryDelay
+	subscriptionRetryDelay = time.Millisecond
+	t.Cleanup(func() { subscriptionRetryDelay = prev })
+
+	admin := &flakyAdmin{growingAdmin: &growingAdmin{fakeAdmin: newFakeAdmin("orders.created")}, failures: 3}
+	client := &sessionConsumerGroup{sessions: make(chan []string, 1)}
+	server := &KafkaServer{
+		client:  client,
+		options: &KafkaConfig{admin: admin},
+		log:     NewAppLogger(zap.NewNop()),
+	}
+	assert.NoError(t, server.ConsumePattern("orders.*", ConsumerOptions{}, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.StartConsumer(ctx) }()
+
+	select {
+	case topics := <-client.sessions:
+		assert.Equal(t, []string{"orders.created"}, topics)
+	case err := <-done:
+		t.Fatalf("consumer stopped: %v", err)
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.NoError(t, server.consumerError())
+}
@@ -0,0 +1,136 @@
+package kp
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+const defaultQueueSize = 64
+
+// partitionPool handles the messages of one claim with a fixed set of
+// workers. The messages of a key always go to the same worker, so they run in
+// order, and the offset only advances past messages that are all completed.
+type partitionPool struct {
+	server   *KafkaServer
+	session  sarama.ConsumerGroupSession
+	queues   []chan *poolEntry
+	inFlight chan struct{}
+	workers  sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []*poolEntry
+	err     error
+	next    int
+}
+
+type poolEntry struct {
+	message *sarama.ConsumerMessage
+	done    bool
+}
+
+func newPartitionPool(s *KafkaServer, session sarama.ConsumerGroupSession, options ConsumerOptions) *partitionPool {
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	maxInFlight := options.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = options.Concurrency * queueSize
+	}
+
+	p := &partitionPool{
+		server:   s,
+		session:  session,
+		queues:   make([]chan *poolEntry, options.Concurrency),
+		inFlight: make(chan struct{}, maxInFlight),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *poolEntry, queueSize)
+		p.workers.Add(1)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+// consumePool is ConsumeClaim for a topic with ConsumerOptions.Concurrency.
+// A message that cannot be forwarded stops the claim, it and every message
+// after it stay unmarked.
+func (s *KafkaServer) consumePool(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim, route consumerRoute) error {
+	p := newPartitionPool(s, session, route.options)
+
+	for message := range claim.Messages() {
+		if p.failed() != nil {
+			break
+		}
+		p.dispatch(message)
+	}
+
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.workers.Wait()
+	return p.failed()
+}
+
+func (p *partitionPool) dispatch(message *sarama.ConsumerMessage) {
+	p.inFlight <- struct{}{}
+
+	entry := &poolEntry{message: message}
+	p.mu.Lock()
+	p.pending = append(p.pending, entry)
+	worker := p.worker(message)
+	p.mu.Unlock()
+
+	p.queues[worker] <- entry
+}
+
+// worker picks the worker of a message by its key, messages without a key
+// are spread over the workers.
+func (p *partitionPool) worker(message *sarama.ConsumerMessage) int {
+	if len(message.Key) == 0 {
+		p.next = (p.next + 1) % len(p.queues)
+		return p.next
+	}
+	h := fnv.New32a()
+	h.Write(message.Key)
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+func (p *partitionPool) work(queue chan *poolEntry) {
+	defer p.workers.Done()
+
+	for entry := range queue {
+		// after a failure the remaining messages are redelivered anyway
+		if p.failed() == nil {
+			p.complete(entry, p.server.process(p.session, entry.message))
+		}
+		<-p.inFlight
+	}
+}
+
+// complete marks every message up to the first one still running.
+func (p *partitionPool) complete(entry *poolEntry, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return
+	}
+
+	entry.done = true
+	for len(p.pending) > 0 && p.pending[0].done {
+		p.session.MarkMessage(p.pending[0].message, "")
+		p.pending = p.pending[1:]
+	}
+}
+
+func (p *partitionPool) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
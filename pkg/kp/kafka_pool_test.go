@@ -0,0 +1,130 @@
+package kp
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+func keyedMessage(key string, offset int64) *sarama.ConsumerMessage {
+	return &sarama.ConsumerMessage{Topic: "orders", Key: []byte(key), Offset: offset, Value: []byte(`{}`)}
+}
+
+func markedOffsets(session *MockConsumerGroupSession) []int64 {
+	var offsets []int64
+	for _, call := range session.Calls {
+		if call.Method == "MarkMessage" {
+			offsets = append(offsets, call.Arguments.Get(0).(*sarama.ConsumerMessage).Offset)
+		}
+	}
+	return offsets
+}
+
+func TestConsumePoolKeepsKeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int64)
+	active := make(map[string]int)
+	var parallel, maxParallel atomic.Int32
+
+	server := &KafkaServer{log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("orders", ConsumerOptions{Concurrency: 4}, func(ctx IContext) error {
+		m := ctx.(IKafkaContext)
+		mu.Lock()
+		active[m.Key()]++
+		assert.Equal(t, 1, active[m.Key()], "messages of a key ran concurrently")
+		mu.Unlock()
+
+		n := parallel.Add(1)
+		for {
+			prev := maxParallel.Load()
+			if n <= prev || maxParallel.CompareAndSwap(prev, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		parallel.Add(-1)
+
+		mu.Lock()
+		active[m.Key()]--
+		seen[m.Key()] = append(seen[m.Key()], m.Offset())
+		mu.Unlock()
+		return nil
+	})
+
+	var messages []*sarama.ConsumerMessage
+	for i := int64(0); i < 12; i++ {
+		messages = append(messages, keyedMessage([]string{"a", "b", "c"}[i%3], i))
+	}
+	session, err := consumeMessages(server, messages...)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 3, 6, 9}, seen["a"])
+	assert.Equal(t, []int64{1, 4, 7, 10}, seen["b"])
+	assert.Greater(t, maxParallel.Load(), int32(1))
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, markedOffsets(session))
+}
+
+func TestConsumePoolMarksContiguousOffsets(t *testing.T) {
+	release := make(chan struct{})
+	var fast sync.WaitGroup
+	fast.Add(2)
+
+	server := &KafkaServer{log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("orders", ConsumerOptions{Concurrency: 3}, func(ctx IContext) error {
+		// keyless messages go to the workers in turn, offset 0 runs alone
+		if ctx.(IKafkaContext).Offset() == 0 {
+			<-release
+			return nil
+		}
+		fast.Done()
+		return nil
+	})
+
+	session := new(MockConsumerGroupSession)
+	session.On("MarkMessage", mock.Anything, "")
+	channel := make(chan *sarama.ConsumerMessage, 3)
+	channel <- keyedMessage("", 0)
+	channel <- keyedMessage("", 1)
+	channel <- keyedMessage("", 2)
+	close(channel)
+	claim := new(MockConsumerGroupClaim)
+	claim.On("Topic").Return("orders")
+	claim.On("Messages").Return(channel)
+
+	done := make(chan error)
+	go func() { done <- server.ConsumeClaim(session, claim) }()
+
+	fast.Wait()
+	time.Sleep(10 * time.Millisecond)
+	assert.Empty(t, markedOffsets(session), "offsets advanced past a running message")
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []int64{0, 1, 2}, markedOffsets(session))
+}
+
+func TestConsumePoolStopsOnForwardError(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(errors.New("broker down"))
+
+	server := &KafkaServer{producer: producer, log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("orders", ConsumerOptions{Concurrency: 2, DeadLetterTopic: "orders.dlt"}, func(ctx IContext) error {
+		if ctx.(IKafkaContext).Offset() == 1 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+
+	session, err := consumeMessages(server, keyedMessage("a", 0), keyedMessage("a", 1), keyedMessage("a", 2))
+
+	assert.Error(t, err)
+	assert.Equal(t, []int64{0}, markedOffsets(session))
+}
@@ -0,0 +1,310 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+)
+
+// Headers of request/reply messages, see IContext.Request.
+const (
+	HeaderCorrelationID = "x-correlation-id"
+	HeaderReplyTo       = "x-reply-to"
+	HeaderReplyStatus   = "x-reply-status"
+)
+
+var (
+	// ErrRequestReplyDisabled is returned by Request without
+	// KafkaConfig.ReplyTopic.
+	ErrRequestReplyDisabled = errors.New("kafka request/reply is disabled, no reply topic configured")
+	// ErrRequestTimeout is returned by Request when no reply came in time.
+	ErrRequestTimeout = errors.New("kafka request timed out")
+)
+
+// Reply is the answer to a request sent with IContext.Request.
+type Reply struct {
+	Code    int
+	Headers map[string]string
+	Body    []byte
+
+	topic string
+	codec Codec
+}
+
+// Decode decodes the reply body into v with the codec of the reply topic.
+func (r *Reply) Decode(v any) error {
+	return r.codec.Decode(r.topic, r.Body, v)
+}
+
+// replyConsumer reads every partition of the reply topic and hands each reply
+// to the request waiting for its correlation ID. It is not a consumer group
+// member, so every instance sees every reply and ignores the ones of other
+// instances.
+type replyConsumer struct {
+	topic    string
+	consumer sarama.Consumer
+	client   sarama.Client
+	readers  sync.WaitGroup
+	watching sync.WaitGroup
+	done     chan struct{}
+
+	mu         sync.Mutex
+	partitions map[int32]sarama.PartitionConsumer
+	pending    map[string]chan *sarama.ConsumerMessage
+}
+
+func newReplyConsumer(option *KafkaConfig, log ILogger) (*replyConsumer, error) {
+	config, err := option.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(option.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	r, err := startReplyConsumer(consumer, option.ReplyTopic)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	r.client = client
+
+	interval := defaultTopicRefreshInterval
+	if option.TopicRefreshInterval > 0 {
+		interval = time.Duration(option.TopicRefreshInterval)
+	}
+	r.watching.Add(1)
+	go r.watch(interval, log)
+	return r, nil
+}
+
+// startReplyConsumer consumes topic from its newest offsets, only the replies
+// to requests sent from now on matter.
+func startReplyConsumer(consumer sarama.Consumer, topic string) (*replyConsumer, error) {
+	r := &replyConsumer{
+		topic:      topic,
+		consumer:   consumer,
+		done:       make(chan struct{}),
+		partitions: make(map[int32]sarama.PartitionConsumer),
+		pending:    make(map[string]chan *sarama.ConsumerMessage),
+	}
+
+	if err := r.addPartitions(sarama.OffsetNewest); err != nil {
+		r.close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// addPartitions consumes the partitions of the topic that are not consumed
+// yet from offset.
+func (r *replyConsumer) addPartitions(offset int64) error {
+	partitions, err := r.consumer.Partitions(r.topic)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, partition := range partitions {
+		if _, ok := r.partitions[partition]; ok {
+			continue
+		}
+		pc, err := r.consumer.ConsumePartition(r.topic, partition, offset)
+		if err != nil {
+			return err
+		}
+		r.partitions[partition] = pc
+		r.readers.Add(1)
+		go r.read(pc)
+	}
+	return nil
+}
+
+// watch consumes the partitions added to the topic after the start. They are
+// read from their oldest offset, the replies written before a partition was
+// found may still have a request waiting.
+func (r *replyConsumer) watch(interval time.Duration, log ILogger) {
+	defer r.watching.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.client.RefreshMetadata(r.topic); err != nil {
+				log.Printf("Failed to refresh Kafka reply topic %s: %v", r.topic, err)
+				continue
+			}
+			if err := r.addPartitions(sarama.OffsetOldest); err != nil {
+				log.Printf("Failed to consume new partitions of %s: %v", r.topic, err)
+			}
+		}
+	}
+}
+
+func (r *replyConsumer) read(pc sarama.PartitionConsumer) {
+	defer r.readers.Done()
+
+	for message := range pc.Messages() {
+		id := recordHeaders(message.Headers)[HeaderCorrelationID]
+
+		r.mu.Lock()
+		reply, ok := r.pending[id]
+		delete(r.pending, id)
+		r.mu.Unlock()
+
+		if ok {
+			reply <- message
+		}
+	}
+}
+
+// expect registers a request before it is sent, so its reply cannot be missed.
+func (r *replyConsumer) expect(id string) <-chan *sarama.ConsumerMessage {
+	reply := make(chan *sarama.ConsumerMessage, 1)
+	r.mu.Lock()
+	r.pending[id] = reply
+	r.mu.Unlock()
+	return reply
+}
+
+func (r *replyConsumer) forget(id string) {
+	r.mu.Lock()
+	delete(r.pending, id)
+	r.mu.Unlock()
+}
+
+func (r *replyConsumer) close() error {
+	close(r.done)
+	r.watching.Wait()
+
+	r.mu.Lock()
+	for _, pc := range r.partitions {
+		pc.AsyncClose()
+	}
+	r.mu.Unlock()
+	r.readers.Wait()
+
+	err := r.consumer.Close()
+	if r.client != nil {
+		err = errors.Join(err, r.client.Close())
+	}
+	return err
+}
+
+// closeReplies takes the reply consumer under the mutex and waits for its
+// goroutines outside of it.
+func (s *KafkaServer) closeReplies() {
+	s.mutex.Lock()
+	if s.options == nil || s.options.replies == nil {
+		s.mutex.Unlock()
+		return
+	}
+	replies := s.options.replies
+	s.options.replies = nil
+	s.mutex.Unlock()
+
+	s.log.Println("Closing Kafka reply consumer...")
+	if err := replies.close(); err != nil {
+		s.log.Printf("Error closing Kafka reply consumer: %v", err)
+	}
+}
+
+// request publishes payload to topic with a correlation ID and the reply
+// topic, then waits for the reply.
+func request(ctx context.Context, cfg *KafkaConfig, topic string, payload any, timeout time.Duration) (*Reply, error) {
+	if cfg == nil || cfg.replies == nil {
+		return nil, ErrRequestReplyDisabled
+	}
+	replies := cfg.replies
+
+	id := uuid.NewString()
+	wait := replies.expect(id)
+	defer replies.forget(id)
+
+	_, err := producer(ctx, cfg.producer, cfg.codec(topic), topic, payload, OptionProducerMsg{
+		headers: []map[string]string{{HeaderCorrelationID: id, HeaderReplyTo: replies.topic}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case message := <-wait:
+		headers := recordHeaders(message.Headers)
+		code, _ := strconv.Atoi(headers[HeaderReplyStatus])
+		return &Reply{
+			Code:    code,
+			Headers: headers,
+			Body:    message.Value,
+			topic:   replies.topic,
+			codec:   cfg.codec(replies.topic),
+		}, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: no reply from %s after %s", ErrRequestTimeout, topic, timeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reply publishes the response of a consumer handler to the reply-to topic of
+// the request. Messages that are not requests get no reply.
+func (ctx *kafkaContext) reply(code int, data any) error {
+	return publishReply(ctx.Context(), ctx.producer, ctx.options, ctx.headers, code, data)
+}
+
+// replyError answers a request whose handler failed for good with the error
+// body of DefaultErrorHandler, the requester need not wait out its timeout.
+func (s *KafkaServer) replyError(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, cause error) error {
+	headers := recordHeaders(message.Headers)
+	if headers[HeaderReplyTo] == "" {
+		return nil
+	}
+
+	e := AsError(cause)
+	body := map[string]any{
+		"code":  e.Code,
+		"error": e.Message,
+	}
+	if e.Details != nil {
+		body["details"] = e.Details
+	}
+	return publishReply(session.Context(), s.producer, s.options, headers, e.Status, body)
+}
+
+func publishReply(ctx context.Context, syncProducer sarama.SyncProducer, cfg *KafkaConfig, headers map[string]string, code int, data any) error {
+	replyTo := headers[HeaderReplyTo]
+	if replyTo == "" {
+		return nil
+	}
+
+	c, span := otel.GetTracerProvider().Tracer("gokp").Start(ctx, "kafka-producer-"+replyTo)
+	defer span.End()
+
+	_, err := producer(c, syncProducer, cfg.codec(replyTo), replyTo, data, OptionProducerMsg{
+		headers: []map[string]string{{
+			HeaderCorrelationID: headers[HeaderCorrelationID],
+			HeaderReplyStatus:   strconv.Itoa(code),
+		}},
+	})
+	return err
+}
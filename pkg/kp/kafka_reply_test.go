@@ -0,0 +1,178 @@
+package kp
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestReplyConsumer(t *testing.T) (*replyConsumer, *mocks.PartitionConsumer) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{"replies": {0}})
+	partition := consumer.ExpectConsumePartition("replies", 0, sarama.OffsetNewest)
+
+	replies, err := startReplyConsumer(consumer, "replies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { replies.close() })
+	return replies, partition
+}
+
+func TestRequestWaitsForReply(t *testing.T) {
+	replies, partition := newTestReplyConsumer(t)
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		headers := headerMap(msg.Headers)
+		assert.Equal(t, "replies", headers[HeaderReplyTo])
+
+		// a reply of another instance first, it must be ignored
+		partition.YieldMessage(&sarama.ConsumerMessage{Topic: "replies", Value: []byte(`{"id":"other"}`), Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderCorrelationID), Value: []byte("other")},
+		}})
+		partition.YieldMessage(&sarama.ConsumerMessage{Topic: "replies", Value: []byte(`{"id":"1"}`), Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderCorrelationID), Value: []byte(headers[HeaderCorrelationID])},
+			{Key: []byte(HeaderReplyStatus), Value: []byte("201")},
+		}})
+		return nil
+	})
+
+	cfg := &KafkaConfig{producer: producer, replies: replies}
+	reply, err := request(context.Background(), cfg, "books.create", map[string]string{"title": "Dune"}, time.Second)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 201, reply.Code)
+		var body map[string]string
+		assert.NoError(t, reply.Decode(&body))
+		assert.Equal(t, "1", body["id"])
+	}
+	assert.Empty(t, replies.pending)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	replies, _ := newTestReplyConsumer(t)
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndSucceed()
+
+	_, err := request(context.Background(), &KafkaConfig{producer: producer, replies: replies}, "books.create", "{}", 10*time.Millisecond)
+
+	assert.ErrorIs(t, err, ErrRequestTimeout)
+	assert.Empty(t, replies.pending)
+}
+
+func TestRequestDisabled(t *testing.T) {
+	_, err := request(context.Background(), &KafkaConfig{}, "books.create", "{}", time.Second)
+	assert.ErrorIs(t, err, ErrRequestReplyDisabled)
+}
+
+func TestConsumerResponsePublishesReply(t *testing.T) {
+	var replied *sarama.ProducerMessage
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		replied = msg
+		return nil
+	})
+
+	server := &KafkaServer{producer: producer, log: NewAppLogger(zap.NewNop())}
+	server.Consume("books.create", func(ctx IContext) error {
+		return ctx.Response(201, map[string]string{"id": "1"})
+	})
+	server.Consume("books.log", func(ctx IContext) error {
+		return ctx.Response(200, "ignored")
+	})
+
+	_, err := consumeMessages(server,
+		&sarama.ConsumerMessage{Topic: "books.create", Value: []byte(`{}`), Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderCorrelationID), Value: []byte("c-1")},
+			{Key: []byte(HeaderReplyTo), Value: []byte("replies")},
+		}},
+		&sarama.ConsumerMessage{Topic: "books.log", Value: []byte(`{}`)},
+	)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, replied) {
+		assert.Equal(t, "replies", replied.Topic)
+		headers := headerMap(replied.Headers)
+		assert.Equal(t, "c-1", headers[HeaderCorrelationID])
+		assert.Equal(t, "201", headers[HeaderReplyStatus])
+		value, _ := replied.Value.Encode()
+		assert.JSONEq(t, `{"id":"1"}`, string(value))
+	}
+}
+
+func TestConsumerFailureRepliesError(t *testing.T) {
+	var replied []*sarama.ProducerMessage
+	producer := mocks.NewSyncProducer(t, nil)
+	record := func(msg *sarama.ProducerMessage) error {
+		replied = append(replied, msg)
+		return nil
+	}
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+
+	server := &KafkaServer{producer: producer, log: NewAppLogger(zap.NewNop())}
+	server.ConsumeWithOptions("books.create", ConsumerOptions{
+		RetryTopics:     []string{"books.create.retry"},
+		DeadLetterTopic: "books.create.dlq",
+	}, func(ctx IContext) error {
+		return NewError(http.StatusServiceUnavailable, "UNAVAILABLE", "50300", "author service down")
+	})
+
+	request := []*sarama.RecordHeader{
+		{Key: []byte(HeaderCorrelationID), Value: []byte("c-1")},
+		{Key: []byte(HeaderReplyTo), Value: []byte("replies")},
+	}
+	_, err := consumeMessages(server,
+		&sarama.ConsumerMessage{Topic: "books.create", Value: []byte(`{}`), Headers: request},
+		&sarama.ConsumerMessage{Topic: "books.create.retry", Value: []byte(`{}`), Headers: request},
+	)
+
+	assert.NoError(t, err)
+	if assert.Len(t, replied, 3) {
+		assert.Equal(t, "books.create.retry", replied[0].Topic, "a retry topic left, no reply yet")
+		assert.Equal(t, "books.create.dlq", replied[1].Topic)
+		assert.Equal(t, "replies", replied[2].Topic)
+		headers := headerMap(replied[2].Headers)
+		assert.Equal(t, "c-1", headers[HeaderCorrelationID])
+		assert.Equal(t, "503", headers[HeaderReplyStatus])
+		value, _ := replied[2].Value.Encode()
+		assert.JSONEq(t, `{"code":"UNAVAILABLE","error":"author service down"}`, string(value))
+	}
+}
+
+func TestReplyConsumerAddsNewPartitions(t *testing.T) {
+	consumer := mocks.NewConsumer(t, nil)
+	consumer.SetTopicMetadata(map[string][]int32{"replies": {0}})
+	consumer.ExpectConsumePartition("replies", 0, sarama.OffsetNewest)
+
+	replies, err := startReplyConsumer(consumer, "replies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replies.close()
+
+	consumer.SetTopicMetadata(map[string][]int32{"replies": {0, 1}})
+	added := consumer.ExpectConsumePartition("replies", 1, sarama.OffsetOldest)
+	assert.NoError(t, replies.addPartitions(sarama.OffsetOldest))
+	assert.NoError(t, replies.addPartitions(sarama.OffsetOldest), "a partition is consumed once")
+
+	wait := replies.expect("c-1")
+	added.YieldMessage(&sarama.ConsumerMessage{Topic: "replies", Headers: []*sarama.RecordHeader{
+		{Key: []byte(HeaderCorrelationID), Value: []byte("c-1")},
+	}})
+
+	select {
+	case message := <-wait:
+		assert.Equal(t, "replies", message.Topic)
+	case <-time.After(time.Second):
+		t.Fatal("the reply on the new partition was not read")
+	}
+}
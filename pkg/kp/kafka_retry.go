@@ -0,0 +1,184 @@
+package kp
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Headers added to a message forwarded to a retry or dead-letter topic.
+const (
+	HeaderError           = "x-error"
+	HeaderAttempt         = "x-attempt"
+	HeaderOriginTopic     = "x-origin-topic"
+	HeaderOriginPartition = "x-origin-partition"
+	HeaderOriginOffset    = "x-origin-offset"
+)
+
+// ConsumerOptions controls what happens to a message whose handler fails.
+//
+// The handler is first retried in process following Retry. When it still
+// fails the message moves to the next of RetryTopics, which are consumed by
+// the same handler, and after the last one to DeadLetterTopic. Without retry
+// topics and dead-letter topic the failed message is logged and skipped.
+// An error that is not retryable, e.g. the InvalidInput of a message that
+// fails to bind, skips the retries and goes straight to DeadLetterTopic.
+//
+// With Processed the handler is skipped for a message it already handled
+// successfully, see MessageID.
+//
+// With Concurrency above 1 the messages of a partition are handled by that
+// many workers, see consumePool. QueueSize bounds the messages waiting for
+// one worker and MaxInFlight the messages of a partition not yet completed.
+//
+// RateLimit bounds the messages of the topic handled per second, in bursts of
+// up to RateBurst. With CircuitPause a handler error wrapping ErrCircuitOpen
+// pauses the topic for that long, then the message is handled again.
+type ConsumerOptions struct {
+	Retry           RetryConfig
+	RetryTopics     []string
+	DeadLetterTopic string
+	Processed       ProcessedStore
+
+	Concurrency int
+	QueueSize   int
+	MaxInFlight int
+
+	RateLimit    float64
+	RateBurst    int
+	CircuitPause time.Duration
+}
+
+// RetryTopics names n retry topics of topic: topic.retry.1 ... topic.retry.n.
+func RetryTopics(topic string, n int) []string {
+	topics := make([]string, 0, n)
+	for i := 1; i <= n; i++ {
+		topics = append(topics, fmt.Sprintf("%s.retry.%d", topic, i))
+	}
+	return topics
+}
+
+// DeadLetterTopic names the dead-letter topic of topic: topic.dlt.
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlt"
+}
+
+// retryable reports whether handling the message again may succeed, a *Error
+// with a 4xx status is a permanent failure.
+func retryable(err error) bool {
+	return AsError(err).Status >= 500
+}
+
+// consumerRoute is the retry setup of one subscribed topic, next is where a
+// message that keeps failing goes. origin is the topic passed to Consume, its
+// codec decodes the messages of the retry topics too.
+type consumerRoute struct {
+	options ConsumerOptions
+	origin  string
+	next    string
+}
+
+// handle runs the handler of a message with the in-process retries of its
+// topic. The returned count is the number of attempts made.
+func (s *KafkaServer) handle(session sarama.ConsumerGroupSession, message *sarama.ConsumerMessage, handler ServiceHandleFunc, route consumerRoute) (int, error) {
+	ctx, span := startConsumerSpan(message)
+	defer span.End()
+
+	origin := route.origin
+	if origin == "" {
+		// a pattern route, a retried message keeps the codec of its first topic
+		origin = message.Topic
+		if o := recordHeaders(message.Headers)[HeaderOriginTopic]; o != "" {
+			origin = o
+		}
+	}
+	codec := s.options.codec(origin)
+
+	attempts := 0
+	// a permanent failure ends Retry as if it succeeded and is returned below
+	var permanent error
+	run := func() (struct{}, error) {
+		attempts++
+		start := time.Now()
+		kctx := newMessageContext(ctx, message, s.producer, s.log)
+		kctx.async = s.async
+		kctx.options = s.options
+		kctx.codec = codec
+		err := handler(kctx)
+		observeConsumed(message.Topic, start, err)
+		if err != nil && !retryable(err) {
+			permanent = err
+			return struct{}{}, nil
+		}
+		return struct{}{}, err
+	}
+
+	var err error
+	if route.options.Retry.MaxAttempts <= 1 {
+		_, err = run()
+	} else {
+		_, err = Retry(session.Context(), route.options.Retry, run)
+	}
+	if permanent != nil {
+		err = permanent
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.SetAttributes(attribute.Int("messaging.kafka.attempts", attempts))
+	return attempts, err
+}
+
+// forward publishes a failed message to topic with its key and headers and
+// the error, attempt and origin headers.
+func (s *KafkaServer) forward(topic string, message *sarama.ConsumerMessage, attempts int, cause error) error {
+	headers := make(map[string]string)
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(message.Value),
+	}
+	if message.Key != nil {
+		msg.Key = sarama.ByteEncoder(message.Key)
+	}
+
+	for _, h := range message.Headers {
+		if h == nil {
+			continue
+		}
+		key := string(h.Key)
+		switch key {
+		case HeaderError, HeaderAttempt:
+			headers[key] = string(h.Value)
+			continue
+		case HeaderOriginTopic, HeaderOriginPartition, HeaderOriginOffset:
+			headers[key] = string(h.Value)
+		}
+		msg.Headers = append(msg.Headers, *h)
+	}
+
+	previous, _ := strconv.Atoi(headers[HeaderAttempt])
+	extra := map[string]string{
+		HeaderError:   cause.Error(),
+		HeaderAttempt: strconv.Itoa(previous + attempts),
+	}
+	// the origin stays the first topic the message failed on
+	if _, ok := headers[HeaderOriginTopic]; !ok {
+		extra[HeaderOriginTopic] = message.Topic
+		extra[HeaderOriginPartition] = strconv.Itoa(int(message.Partition))
+		extra[HeaderOriginOffset] = strconv.FormatInt(message.Offset, 10)
+	}
+	for _, key := range []string{HeaderError, HeaderAttempt, HeaderOriginTopic, HeaderOriginPartition, HeaderOriginOffset} {
+		if value, ok := extra[key]; ok {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+		}
+	}
+
+	_, _, err := s.producer.SendMessage(msg)
+	observeProduced(topic, err)
+	return err
+}
@@ -0,0 +1,202 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func consumeMessages(server *KafkaServer, messages ...*sarama.ConsumerMessage) (*MockConsumerGroupSession, error) {
+	session := new(MockConsumerGroupSession)
+	session.On("MarkMessage", mock.Anything, "")
+	session.On("Context").Return(context.Background())
+
+	channel := make(chan *sarama.ConsumerMessage, len(messages))
+	for _, m := range messages {
+		channel <- m
+	}
+	close(channel)
+
+	claim := new(MockConsumerGroupClaim)
+	claim.On("Messages").Return(channel)
+	if len(messages) > 0 {
+		claim.On("Topic").Return(messages[0].Topic)
+	}
+
+	return session, server.ConsumeClaim(session, claim)
+}
+
+func headerMap(headers []sarama.RecordHeader) map[string]string {
+	m := make(map[string]string, len(headers))
+	for _, h := range headers {
+		m[string(h.Key)] = string(h.Value)
+	}
+	return m
+}
+
+func TestRetryTopicNames(t *testing.T) {
+	assert.Equal(t, []string{"orders.retry.1", "orders.retry.2"}, RetryTopics("orders", 2))
+	assert.Equal(t, "orders.dlt", DeadLetterTopic("orders"))
+}
+
+func TestConsumeWithOptionsRegistersRetryTopics(t *testing.T) {
+	server := &KafkaServer{log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{
+		RetryTopics:     RetryTopics("orders", 2),
+		DeadLetterTopic: "orders.dlt",
+	}, func(ctx IContext) error { return nil })
+
+	assert.Equal(t, []string{"orders", "orders.retry.1", "orders.retry.2"}, server.topics)
+	assert.Equal(t, "orders.retry.1", server.routes["orders"].next)
+	assert.Equal(t, "orders.retry.2", server.routes["orders.retry.1"].next)
+	assert.Equal(t, "orders.dlt", server.routes["orders.retry.2"].next)
+	assert.NotNil(t, server.handlers["orders.retry.2"])
+}
+
+func TestConsumeClaimRetriesInProcess(t *testing.T) {
+	calls := 0
+	server := &KafkaServer{producer: mocks.NewSyncProducer(t, nil), log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{
+		Retry:           RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		DeadLetterTopic: "orders.dlt",
+	}, func(ctx IContext) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+
+	session, err := consumeMessages(server, &sarama.ConsumerMessage{Topic: "orders", Value: []byte(`{}`)})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	session.AssertNumberOfCalls(t, "MarkMessage", 1)
+}
+
+func TestConsumeClaimForwardsToRetryTopic(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "orders.retry.1", msg.Topic)
+		key, _ := msg.Key.Encode()
+		assert.Equal(t, "order-1", string(key))
+		headers := headerMap(msg.Headers)
+		assert.Equal(t, "trace", headers["x-trace"])
+		assert.Equal(t, "boom", headers[HeaderError])
+		assert.Equal(t, "2", headers[HeaderAttempt])
+		assert.Equal(t, "orders", headers[HeaderOriginTopic])
+		assert.Equal(t, "3", headers[HeaderOriginPartition])
+		assert.Equal(t, "42", headers[HeaderOriginOffset])
+		return nil
+	})
+
+	server := &KafkaServer{producer: producer, log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{
+		Retry:           RetryConfig{MaxAttempts: 2},
+		RetryTopics:     RetryTopics("orders", 1),
+		DeadLetterTopic: "orders.dlt",
+	}, func(ctx IContext) error { return errors.New("boom") })
+
+	_, err := consumeMessages(server, &sarama.ConsumerMessage{
+		Topic:     "orders",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("order-1"),
+		Value:     []byte(`{}`),
+		Headers:   []*sarama.RecordHeader{{Key: []byte("x-trace"), Value: []byte("trace")}},
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestConsumeClaimForwardsToDeadLetterTopic(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "orders.dlt", msg.Topic)
+		headers := headerMap(msg.Headers)
+		assert.Equal(t, "still failing", headers[HeaderError])
+		assert.Equal(t, "3", headers[HeaderAttempt])
+		assert.Equal(t, "orders", headers[HeaderOriginTopic])
+		assert.Equal(t, "42", headers[HeaderOriginOffset])
+		assert.Len(t, msg.Headers, 5)
+		return nil
+	})
+
+	server := &KafkaServer{producer: producer, log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{
+		RetryTopics:     RetryTopics("orders", 1),
+		DeadLetterTopic: "orders.dlt",
+	}, func(ctx IContext) error { return errors.New("still failing") })
+
+	_, err := consumeMessages(server, &sarama.ConsumerMessage{
+		Topic:  "orders.retry.1",
+		Offset: 7,
+		Value:  []byte(`{}`),
+		Headers: []*sarama.RecordHeader{
+			{Key: []byte(HeaderError), Value: []byte("boom")},
+			{Key: []byte(HeaderAttempt), Value: []byte("2")},
+			{Key: []byte(HeaderOriginTopic), Value: []byte("orders")},
+			{Key: []byte(HeaderOriginPartition), Value: []byte("0")},
+			{Key: []byte(HeaderOriginOffset), Value: []byte("42")},
+		},
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestConsumeClaimForwardFailureKeepsMessage(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+
+	server := &KafkaServer{producer: producer, log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{DeadLetterTopic: "orders.dlt"}, func(ctx IContext) error {
+		return errors.New("boom")
+	})
+
+	session, err := consumeMessages(server, &sarama.ConsumerMessage{Topic: "orders", Value: []byte(`{}`)})
+
+	assert.ErrorIs(t, err, sarama.ErrOutOfBrokers)
+	session.AssertNotCalled(t, "MarkMessage", mock.Anything, "")
+}
+
+func TestConsumeClaimSendsPermanentFailureToDeadLetterTopic(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		assert.Equal(t, "orders.dlt", msg.Topic, "the retry topics are skipped")
+		assert.Equal(t, "1", headerMap(msg.Headers)[HeaderAttempt], "the in-process retries are skipped")
+		return nil
+	})
+
+	type order struct {
+		ID string `json:"id" validate:"required"`
+	}
+	calls := 0
+	server := &KafkaServer{producer: producer, log: NewMockLogger()}
+	server.ConsumeWithOptions("orders", ConsumerOptions{
+		Retry:           RetryConfig{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		RetryTopics:     RetryTopics("orders", 2),
+		DeadLetterTopic: "orders.dlt",
+	}, Message("create_order", "order", func(ctx IContext, req order) error {
+		calls++
+		return nil
+	}))
+
+	session, err := consumeMessages(server, &sarama.ConsumerMessage{Topic: "orders", Value: []byte(`{}`)})
+
+	assert.NoError(t, err)
+	assert.Zero(t, calls)
+	session.AssertNumberOfCalls(t, "MarkMessage", 1)
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, retryable(errors.New("connection refused")))
+	assert.True(t, retryable(Internal(errors.New("boom"))))
+	assert.False(t, retryable(NotFound("author not found")))
+	assert.False(t, retryable(InvalidInput(&ValidationError{})))
+}
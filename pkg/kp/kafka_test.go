@@ -209,6 +209,7 @@ func TestConsumeClaim(t *testing.T) {
 	mockMessageChannel := make(chan *sarama.ConsumerMessage, 1)
 
 	// Setup mock claim expectations
+	mockClaim.On("Topic").Return("test_topic")
 	mockClaim.On("Messages").Return(mockMessageChannel).Once()
 	go func() {
 		// Simulate sending a message to the channel
@@ -257,6 +258,7 @@ func TestConsumeClaimHandlerError(t *testing.T) {
 	mockMessageChannel := make(chan *sarama.ConsumerMessage, 1)
 
 	// Setup mock claim expectations
+	mockClaim.On("Topic").Return(topic)
 	mockClaim.On("Messages").Return(mockMessageChannel).Once()
 	go func() {
 		// Simulate sending a message to the channel
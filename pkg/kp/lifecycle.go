@@ -0,0 +1,182 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sing3demons/go-library-api/pkg/kp/logger"
+)
+
+const defaultShutdownTimeout = 15 * time.Second
+
+// Hook runs when the server starts or stops, see Server.OnStart and
+// Server.OnStop.
+type Hook func(ctx context.Context) error
+
+// OnStart registers a hook that runs before the server accepts requests and
+// messages. A failing hook stops the start.
+func (s *Server) OnStart(hook Hook) {
+	s.onStart = append(s.onStart, hook)
+}
+
+// OnStop registers a hook that runs last in the shutdown, e.g. to close a
+// database client. The hooks run in the reverse order of registration.
+func (s *Server) OnStop(hook Hook) {
+	s.onStop = append(s.onStop, hook)
+}
+
+// Start runs the server until SIGINT or SIGTERM, then shuts it down, see
+// shutdown.
+func (s *Server) Start() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.run(ctx); err != nil {
+		s.Log.Printf("Application stopped with error: %v", err)
+		return
+	}
+	s.Log.Println("Application exited cleanly")
+}
+
+// run starts the HTTP server, the Kafka consumer and the outbox relay and
+// blocks until ctx is done or the HTTP server fails.
+func (s *Server) run(ctx context.Context) error {
+	for _, hook := range s.onStart {
+		if err := hook(ctx); err != nil {
+			return errors.Join(err, s.stopHooks(context.Background()))
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	if s.router != nil {
+		s.httpServer = s.router.Register()
+		s.httpServer.Handler = metricsHandler(s.health.handler(s.httpServer.Handler))
+
+		go func() {
+			s.Log.Println("Starting HTTP server on " + s.httpServer.Addr)
+			if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
+	}
+
+	// the consumer has its own context, it runs until the shutdown stops it
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		s.Log.Println("Starting Kafka consumer...")
+		if err := s.kafka.StartConsumer(consumerCtx); err != nil {
+			s.Log.Printf("Kafka consumer error: %v", err)
+		}
+	}()
+
+	if s.outbox != nil {
+		s.Log.Println("Starting outbox relay...")
+		s.outbox.start()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		s.Log.Println("Shutdown signal received")
+	case err = <-serveErr:
+		s.Log.Printf("HTTP Server Error: %v", err)
+	}
+
+	return errors.Join(err, s.shutdown(stopConsumer, consumerDone))
+}
+
+// shutdown stops the server within the shutdown timeout, in order:
+//
+//  1. mark the service not ready and wait the drain delay
+//  2. stop accepting HTTP requests and wait for the running ones
+//  3. stop the outbox relay
+//  4. stop the Kafka consumers once their handlers finish the current messages
+//  5. flush and close the Kafka producers and the admin client
+//  6. flush the loggers
+//  7. shut down the tracer
+//  8. run the OnStop hooks, e.g. close the database clients
+//
+// The hooks get a timeout of their own, a consumer that used up the shutdown
+// timeout must not keep the database clients from closing.
+func (s *Server) shutdown(stopConsumer context.CancelFunc, consumerDone <-chan struct{}) error {
+	timeout := s.shutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+
+	s.health.shuttingDown.Store(true)
+	if s.drainDelay > 0 && s.httpServer != nil {
+		s.Log.Printf("Draining for %s before closing the HTTP server", s.drainDelay)
+		select {
+		case <-time.After(s.drainDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			s.Log.Printf("HTTP Server Shutdown Error: %v", err)
+			errs = append(errs, err)
+		} else {
+			s.Log.Println("HTTP server shutdown complete")
+		}
+	}
+
+	if s.outbox != nil {
+		s.outbox.stop()
+	}
+
+	stopConsumer()
+	select {
+	case <-consumerDone:
+	case <-ctx.Done():
+		s.Log.Println("Kafka consumer did not stop before the shutdown timeout")
+		errs = append(errs, ctx.Err())
+	}
+	s.kafka.closeConsumer()
+	s.kafka.closeReplies()
+	s.kafka.closeProducers()
+	s.kafka.closeAdmin()
+
+	// syncing stdout fails on some platforms, only the log files count
+	s.Log.Sync()
+	if err := logger.Sync(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.traceProvider != nil {
+		if err := s.traceProvider.Shutdown(ctx); err != nil {
+			s.Log.Println("failed to stop trace provider:", err)
+			errs = append(errs, err)
+		}
+	}
+
+	hookCtx, cancelHooks := context.WithTimeout(context.Background(), timeout)
+	defer cancelHooks()
+	if err := s.stopHooks(hookCtx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) stopHooks(ctx context.Context) error {
+	var errs []error
+	for i := len(s.onStop) - 1; i >= 0; i-- {
+		if err := s.onStop[i](ctx); err != nil {
+			s.Log.Printf("Stop hook error: %v", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,114 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newLifecycleApplication() *Server {
+	return NewApplication(&Config{
+		AppConfig: AppConfig{Port: "0", Router: Gin},
+	}, NewAppLogger(zap.NewNop())).(*Server)
+}
+
+func TestRunCallsHooksInOrder(t *testing.T) {
+	app := newLifecycleApplication()
+
+	var calls []string
+	hook := func(name string) Hook {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	app.OnStart(hook("start 1"))
+	app.OnStart(hook("start 2"))
+	app.OnStop(hook("stop 1"))
+	app.OnStop(func(ctx context.Context) error {
+		assert.True(t, app.health.shuttingDown.Load(), "stop hook ran before the service was marked not ready")
+		calls = append(calls, "stop 2")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.NoError(t, app.run(ctx))
+	assert.Equal(t, []string{"start 1", "start 2", "stop 2", "stop 1"}, calls)
+}
+
+func TestRunFailingStartHook(t *testing.T) {
+	app := newLifecycleApplication()
+
+	stopped := false
+	app.OnStart(func(ctx context.Context) error { return errors.New("migration failed") })
+	app.OnStop(func(ctx context.Context) error {
+		stopped = true
+		return nil
+	})
+
+	err := app.run(context.Background())
+
+	assert.EqualError(t, err, "migration failed")
+	assert.True(t, stopped)
+	assert.Nil(t, app.httpServer)
+}
+
+func TestRunReturnsStopHookErrors(t *testing.T) {
+	app := newLifecycleApplication()
+	app.OnStop(func(ctx context.Context) error { return errors.New("close failed") })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.EqualError(t, app.run(ctx), "close failed")
+}
+
+func TestShutdownDrainDelay(t *testing.T) {
+	app := newLifecycleApplication()
+	app.drainDelay = 300 * time.Millisecond
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.httpServer = &http.Server{Handler: app.health.handler(http.NotFoundHandler())}
+	go app.httpServer.Serve(listener)
+
+	consumerDone := make(chan struct{})
+	close(consumerDone)
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- app.shutdown(func() {}, consumerDone) }()
+
+	assert.Eventually(t, app.health.shuttingDown.Load, time.Second, time.Millisecond)
+	resp, err := http.Get("http://" + listener.Addr().String() + "/health/ready")
+	if assert.NoError(t, err, "the listener closed before the drain delay") {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	assert.NoError(t, <-shutdownErr)
+}
+
+func TestShutdownStopHooksOwnTimeout(t *testing.T) {
+	app := newLifecycleApplication()
+	app.shutdownTimeout = 50 * time.Millisecond
+
+	var hookErr error
+	app.OnStop(func(ctx context.Context) error {
+		hookErr = ctx.Err()
+		return nil
+	})
+
+	// the consumer never stops and uses up the shutdown timeout
+	err := app.shutdown(func() {}, make(chan struct{}))
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, hookErr)
+}
@@ -42,6 +42,7 @@ const (
 	xSession        ContextKey = "session"
 	ContentType                = "Content-Type"
 	ContentTypeJSON            = "application/json"
+	XRequestID                 = "x-request-id"
 	key             ContextKey = "logger"
 	Summary                    = "Summary"
 	Detail                     = "Detail"
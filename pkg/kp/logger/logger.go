@@ -2,6 +2,7 @@ package logger
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -16,8 +17,8 @@ import (
 )
 
 type LogConfig struct {
-	ProjectName string
-	Namespace   string
+	ProjectName string           `json:"projectName"`
+	Namespace   string           `json:"namespace"`
 	AppLog      AppLog           `json:"appLog"`
 	Summary     SummaryLogConfig `json:"summary"`
 	Detail      DetailLogConfig  `json:"detail"`
@@ -28,23 +29,23 @@ type AppLog struct {
 	LogFile    bool          `json:"logFile"`
 	LogConsole bool          `json:"logConsole"`
 	LogLevel   zapcore.Level `json:"logLevel"`
-	AppLog     *zap.Logger
+	AppLog     *zap.Logger   `json:"-"`
 }
 
 type SummaryLogConfig struct {
-	Name       string `json:"name"`
-	RawData    bool   `json:"rawData"`
-	LogFile    bool   `json:"logFile"`
-	LogConsole bool   `json:"logConsole"`
-	LogSummary *zap.Logger
+	Name       string      `json:"name"`
+	RawData    bool        `json:"rawData"`
+	LogFile    bool        `json:"logFile"`
+	LogConsole bool        `json:"logConsole"`
+	LogSummary *zap.Logger `json:"-"`
 }
 
 type DetailLogConfig struct {
-	Name       string `json:"name"`
-	RawData    bool   `json:"rawData"`
-	LogFile    bool   `json:"logFile"`
-	LogConsole bool   `json:"logConsole"`
-	LogDetail  *zap.Logger
+	Name       string      `json:"name"`
+	RawData    bool        `json:"rawData"`
+	LogFile    bool        `json:"logFile"`
+	LogConsole bool        `json:"logConsole"`
+	LogDetail  *zap.Logger `json:"-"`
 }
 
 type InputOutputLog struct {
@@ -309,4 +310,17 @@ func getLogFileName(t time.Time) string {
 	hour, minute, second := t.Clock()
 
 	return fmt.Sprintf("%s_%04d%02d%02d_%02d%02d%02d.log", appName, year, month, day, hour, minute, second)
-}
\ No newline at end of file
+}
+
+// Sync flushes the app, detail and summary log files.
+func Sync() error {
+	var errs []error
+	for _, l := range []*zap.Logger{configLog.AppLog.AppLog, configLog.Detail.LogDetail, configLog.Summary.LogSummary} {
+		if l != nil {
+			if err := l.Sync(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
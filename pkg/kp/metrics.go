@@ -0,0 +1,118 @@
+package kp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsPath = "/metrics"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests by route, method and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Latency of HTTP requests by route, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	kafkaConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_consumed_total",
+		Help: "Number of Kafka messages consumed by topic.",
+	}, []string{"topic"})
+
+	kafkaProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_produced_total",
+		Help: "Number of Kafka messages produced by topic and status.",
+	}, []string{"topic", "status"})
+
+	kafkaHandlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_handler_errors_total",
+		Help: "Number of Kafka messages whose handler returned an error, by topic.",
+	}, []string{"topic"})
+
+	kafkaDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_processing_duration_seconds",
+		Help:    "Time spent in the handler of a Kafka message by topic.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+)
+
+// observeHTTP records a handled request. The route is the registered pattern,
+// not the request path, to keep the number of series bounded.
+func observeHTTP(ctx IContext, start time.Time) {
+	c, ok := ctx.(*HttpContext)
+	if !ok {
+		return
+	}
+
+	status := strconv.Itoa(c.Status())
+	method := c.GetMethod()
+	route := c.FullPath()
+	httpRequests.WithLabelValues(method, route, status).Inc()
+	httpDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+}
+
+func observeConsumed(topic string, start time.Time, err error) {
+	kafkaConsumed.WithLabelValues(topic).Inc()
+	kafkaDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	if err != nil {
+		kafkaHandlerErrors.WithLabelValues(topic).Inc()
+	}
+}
+
+func observeProduced(topic string, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	kafkaProduced.WithLabelValues(topic, status).Inc()
+}
+
+// NewCounter registers a counter with the metrics served on /metrics. Asking
+// for a counter that already exists returns the registered one.
+func (s *Server) NewCounter(name, help string, labels ...string) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	return registerCollector(counter)
+}
+
+// NewGauge registers a gauge with the metrics served on /metrics. Asking for a
+// gauge that already exists returns the registered one.
+func (s *Server) NewGauge(name, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+	return registerCollector(gauge)
+}
+
+func registerCollector[T prometheus.Collector](c T) T {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// metricsHandler serves /metrics in front of the router.
+func metricsHandler(next http.Handler) http.Handler {
+	metrics := promhttp.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == metricsPath && r.Method == http.MethodGet {
+			metrics.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouterBackendsHTTPMetrics(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+			app.Get("/metrics-"+name+"/:id", func(ctx IContext) error {
+				return NotFound("book not found")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics-"+name+"/42", nil)
+			app.ServeHTTP(httptest.NewRecorder(), req)
+
+			route := "/metrics-" + name + "/:id"
+			if router == Mux {
+				route = "/metrics-" + name + "/{id}"
+			}
+			assert.Equal(t, float64(1), testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, route, "404")))
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Contains(t, rec.Body.String(), `http_request_duration_seconds_count{method="GET",route="`+route+`",status="404"} 1`)
+		})
+	}
+}
+
+func TestKafkaMetrics(t *testing.T) {
+	observeConsumed("metrics-topic", time.Now(), nil)
+	observeConsumed("metrics-topic", time.Now(), errors.New("failed"))
+	assert.Equal(t, float64(2), testutil.ToFloat64(kafkaConsumed.WithLabelValues("metrics-topic")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(kafkaHandlerErrors.WithLabelValues("metrics-topic")))
+
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageAndSucceed()
+	_, err := producer(context.Background(), mockProducer, JSONCodec{}, "metrics-topic", map[string]string{"id": "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(kafkaProduced.WithLabelValues("metrics-topic", "success")))
+}
+
+func TestCustomMetrics(t *testing.T) {
+	app := newBackendApplication(Gin)
+
+	counter := app.NewCounter("books_created_total", "Number of created books.", "author")
+	counter.WithLabelValues("tolkien").Inc()
+	assert.Same(t, counter, app.NewCounter("books_created_total", "Number of created books.", "author"))
+
+	gauge := app.NewGauge("books_in_stock", "Number of books in stock.")
+	gauge.WithLabelValues().Set(3)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), `books_created_total{author="tolkien"} 1`)
+	assert.Contains(t, rec.Body.String(), `books_in_stock 3`)
+}
@@ -0,0 +1,85 @@
+package kp
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// RequestIDMiddleware makes sure every request or message carries an
+// x-request-id. An incoming id is kept, otherwise a new one is generated.
+// CommonLog picks the id up as the init invoke and HTTP responses echo it.
+func RequestIDMiddleware() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx IContext) error {
+			id := ctx.GetHeader(XRequestID)
+			if id == "" {
+				id = GenerateXTid("clnt")
+				if h, ok := ctx.(interface{ Header() http.Header }); ok {
+					h.Header().Set(XRequestID, id)
+				}
+			}
+			ctx.SetHeader(XRequestID, id)
+			return next(ctx)
+		}
+	}
+}
+
+// RecoveryMiddleware turns a panic in the rest of the chain into an error. It
+// closes the summary log and, unless a response was already sent, writes a
+// JSON 500.
+func RecoveryMiddleware() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx IContext) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+
+				err = fmt.Errorf("panic: %v", r)
+				ctx.Log().Errorf("recovered from %v\n%s", err, debug.Stack())
+
+				if summaryLog := ctx.SummaryLog(); summaryLog != nil && !summaryLog.IsEnd() {
+					summaryLog.End(fmt.Sprintf("%d", http.StatusInternalServerError), err.Error())
+				}
+
+				if w, ok := ctx.(interface{ Written() bool }); !ok || !w.Written() {
+					ctx.Response(http.StatusInternalServerError, map[string]any{"error": "internal server error"})
+				}
+			}()
+
+			return next(ctx)
+		}
+	}
+}
+
+// AccessLogMiddleware writes one line per request or message through ILogger
+// once the rest of the chain has finished.
+func AccessLogMiddleware() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx IContext) error {
+			start := time.Now()
+			err := next(ctx)
+			elapsed := time.Since(start)
+
+			var line string
+			switch c := ctx.(type) {
+			case *HttpContext:
+				line = fmt.Sprintf("%s %s %d %s", c.GetMethod(), c.GetPath(), c.Status(), elapsed)
+			case *kafkaContext:
+				line = fmt.Sprintf("kafka %s %s", c.topic, elapsed)
+			default:
+				line = elapsed.String()
+			}
+
+			if err != nil {
+				ctx.Log().Errorf("%s error: %v", line, err)
+			} else {
+				ctx.Log().Infof("%s", line)
+			}
+			return err
+		}
+	}
+}
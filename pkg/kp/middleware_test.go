@@ -0,0 +1,176 @@
+package kp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareShortCircuitByError(t *testing.T) {
+	app := newBackendApplication(Gin)
+
+	handlerCalled := false
+	app.Get("/test", func(ctx IContext) error {
+		handlerCalled = true
+		return nil
+	}, func(next HandleFunc) HandleFunc {
+		return func(ctx IContext) error {
+			return errors.New("stop")
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	assert.False(t, handlerCalled)
+}
+
+func TestMiddlewareShortCircuitByResponse(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			handlerCalled := false
+			app.Use(func(next HandleFunc) HandleFunc {
+				return func(ctx IContext) error {
+					ctx.Response(http.StatusForbidden, map[string]any{"error": "forbidden"})
+					return next(ctx)
+				}
+			})
+			app.Get("/test", func(ctx IContext) error {
+				handlerCalled = true
+				return nil
+			})
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			assert.False(t, handlerCalled)
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		})
+	}
+}
+
+func TestMiddlewareNextAndPostProcessing(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			handlerErr := errors.New("handler failed")
+			var order []string
+			var seen error
+
+			app.Use(func(next HandleFunc) HandleFunc {
+				return func(ctx IContext) error {
+					order = append(order, "before")
+					seen = ctx.Next()
+					order = append(order, "after")
+					return seen
+				}
+			})
+			app.Get("/test", func(ctx IContext) error {
+				order = append(order, "handler")
+				return handlerErr
+			})
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			assert.Equal(t, []string{"before", "handler", "after"}, order)
+			assert.ErrorIs(t, seen, handlerErr)
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+			app.Use(RequestIDMiddleware())
+
+			var id string
+			app.Get("/test", func(ctx IContext) error {
+				id = ctx.GetHeader(XRequestID)
+				return nil
+			})
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+			assert.NotEmpty(t, id)
+			assert.Equal(t, id, rec.Header().Get(XRequestID))
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(XRequestID, "rid-1")
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, "rid-1", id)
+			assert.Equal(t, "rid-1", rec.Header().Get(XRequestID))
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+			app.Use(RecoveryMiddleware())
+
+			app.Get("/test", func(ctx IContext) error {
+				ctx.CommonLog("panic", "panic")
+				panic("boom")
+			})
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+			var body map[string]any
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, http.StatusInternalServerError, rec.Code)
+			assert.Equal(t, "internal server error", body["error"])
+		})
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	log := NewMockLogger()
+	app := NewApplication(&Config{AppConfig: AppConfig{Port: "8888"}}, log)
+	app.Use(AccessLogMiddleware())
+
+	app.Get("/ok", func(ctx IContext) error {
+		return nil
+	})
+	app.Get("/fail", func(ctx IContext) error {
+		return errors.New("fail")
+	})
+
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Contains(t, log.Calls, "Infof")
+
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	assert.Contains(t, log.Calls, "Errorf")
+}
+
+func TestConsumeMiddleware(t *testing.T) {
+	server, err := NewKafkaServer(mocks.NewSyncProducer(t, nil), &MockConsumerGroup{}, &KafkaConfig{}, NewMockLogger())
+	assert.NoError(t, err)
+
+	var order []string
+	server.Consume(topic, func(ctx IContext) error {
+		order = append(order, "handler")
+		return nil
+	}, RecoveryMiddleware(), func(next HandleFunc) HandleFunc {
+		return func(ctx IContext) error {
+			order = append(order, "middleware")
+			return ctx.Next()
+		}
+	})
+
+	ctx := NewConsumerContext(topic, `{}`, server.producer, server.log)
+	assert.NoError(t, server.handlers[topic](ctx))
+	assert.Equal(t, []string{"middleware", "handler"}, order)
+}
@@ -0,0 +1,204 @@
+package kp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// OutboxMessage is a Kafka message written to the outbox in the same
+// transaction as the change it announces. The relay of Server.UseOutbox
+// publishes it once the transaction has committed.
+type OutboxMessage struct {
+	ID       int64
+	Topic    string
+	Key      string
+	Headers  map[string]string
+	Payload  []byte
+	Attempts int
+}
+
+// NewOutboxMessage encodes payload with codec and keeps the trace of ctx in
+// the headers, the published message continues the trace that wrote it. The
+// codec is the one of topic, see Server.Codec, the relay publishes the
+// payload as is. A nil codec is JSONCodec.
+func NewOutboxMessage(ctx context.Context, codec Codec, topic, key string, payload any) (OutboxMessage, error) {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	data, err := codec.Encode(topic, payload)
+	if err != nil {
+		return OutboxMessage{}, err
+	}
+
+	// the ID is fixed now, a message published twice by the relay is still
+	// recognized by the consumers, see MessageID
+	headers := map[string]string{HeaderMessageID: uuid.NewString()}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(headers))
+	return OutboxMessage{Topic: topic, Key: key, Headers: headers, Payload: data}, nil
+}
+
+func (m OutboxMessage) producerMessage() *sarama.ProducerMessage {
+	msg := &sarama.ProducerMessage{
+		Topic:     m.Topic,
+		Value:     sarama.ByteEncoder(m.Payload),
+		Timestamp: time.Now(),
+	}
+	if m.Key != "" {
+		msg.Key = sarama.StringEncoder(m.Key)
+	}
+	for key, value := range m.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+	}
+	return msg
+}
+
+// OutboxStore is the table the outbox messages are written to, e.g.
+// postgres.Postgres.
+type OutboxStore interface {
+	// ClaimOutbox returns up to limit unsent messages that are due, oldest
+	// first, and hides them from other relays until they are marked.
+	ClaimOutbox(ctx context.Context, limit int) ([]OutboxMessage, error)
+	MarkOutboxSent(ctx context.Context, id int64) error
+	// MarkOutboxFailed counts a failed attempt, the message is claimed again
+	// after retryAt.
+	MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, cause error) error
+}
+
+// OutboxConfig controls the relay. A message that fails to publish is retried
+// after InitialBackoff, doubled on every attempt up to MaxBackoff.
+type OutboxConfig struct {
+	PollInterval   time.Duration
+	BatchSize      int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (c OutboxConfig) withDefaults() OutboxConfig {
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Second
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 5 * time.Minute
+	}
+	return c
+}
+
+// backoff is the delay before the next attempt of a message that has failed
+// attempts times.
+func (c OutboxConfig) backoff(attempts int) time.Duration {
+	delay := c.InitialBackoff
+	for i := 1; i < attempts && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxBackoff {
+		delay = c.MaxBackoff
+	}
+	return delay
+}
+
+// outboxRelay publishes the outbox messages through the sync producer.
+type outboxRelay struct {
+	store    OutboxStore
+	producer sarama.SyncProducer
+	config   OutboxConfig
+	log      ILogger
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+func newOutboxRelay(store OutboxStore, producer sarama.SyncProducer, config OutboxConfig, log ILogger) *outboxRelay {
+	return &outboxRelay{store: store, producer: producer, config: config.withDefaults(), log: log}
+}
+
+func (r *outboxRelay) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		r.run(ctx)
+	}()
+}
+
+// stop waits for the batch in progress, its messages are either marked or
+// claimed again after the lease of the store.
+func (r *outboxRelay) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.done.Wait()
+}
+
+func (r *outboxRelay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.relay(ctx)
+		if err != nil {
+			r.log.Printf("Outbox relay error: %v", err)
+		}
+		// a full batch means more messages are waiting
+		if err == nil && n == r.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay publishes one batch and returns the number of messages claimed.
+func (r *outboxRelay) relay(ctx context.Context) (int, error) {
+	messages, err := r.store.ClaimOutbox(ctx, r.config.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range messages {
+		_, _, err := r.producer.SendMessage(m.producerMessage())
+		observeProduced(m.Topic, err)
+		if err != nil {
+			retryAt := time.Now().Add(r.config.backoff(m.Attempts + 1))
+			r.log.Printf("Outbox message %d to %s failed, retry at %s: %v", m.ID, m.Topic, retryAt.Format(time.RFC3339), err)
+			if mErr := r.store.MarkOutboxFailed(ctx, m.ID, retryAt, err); mErr != nil {
+				return len(messages), mErr
+			}
+			continue
+		}
+
+		// a message published but not marked is published again, consumers
+		// see it at least once
+		if err := r.store.MarkOutboxSent(ctx, m.ID); err != nil {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// UseOutbox starts a relay with the server that publishes the messages of
+// store, see OutboxMessage. The relay stops before the Kafka producer closes.
+func (s *Server) UseOutbox(store OutboxStore, config OutboxConfig) {
+	if s.kafka == nil || s.kafka.producer == nil {
+		s.Log.Println("Outbox relay disabled, no Kafka brokers configured")
+		return
+	}
+	s.outbox = newOutboxRelay(store, s.kafka.producer, config, s.Log)
+}
@@ -0,0 +1,126 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+)
+
+type fakeOutboxStore struct {
+	mu       sync.Mutex
+	messages []OutboxMessage
+	sent     []int64
+	failed   map[int64]time.Time
+}
+
+func (s *fakeOutboxStore) ClaimOutbox(ctx context.Context, limit int) ([]OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(limit, len(s.messages))
+	claimed := s.messages[:n]
+	s.messages = s.messages[n:]
+	return claimed, nil
+}
+
+func (s *fakeOutboxStore) MarkOutboxSent(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, id)
+	return nil
+}
+
+func (s *fakeOutboxStore) MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failed == nil {
+		s.failed = make(map[int64]time.Time)
+	}
+	s.failed[id] = retryAt
+	return nil
+}
+
+func TestNewOutboxMessageKeepsTrace(t *testing.T) {
+	useTestTracer(t)
+	ctx, span := otel.Tracer("test").Start(context.Background(), "http")
+	defer span.End()
+
+	message, err := NewOutboxMessage(ctx, nil, "book-log", "1", map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "book-log", message.Topic)
+	assert.JSONEq(t, `{"id":"1"}`, string(message.Payload))
+	assert.Contains(t, message.Headers["traceparent"], span.SpanContext().TraceID().String())
+}
+
+func TestOutboxRelayPublishesAndMarksSent(t *testing.T) {
+	store := &fakeOutboxStore{messages: []OutboxMessage{
+		{ID: 1, Topic: "book-log", Key: "a", Headers: map[string]string{"x-request-id": "r1"}, Payload: []byte(`{"id":"a"}`)},
+		{ID: 2, Topic: "book-log", Key: "b", Payload: []byte(`{"id":"b"}`)},
+	}}
+
+	var published []*sarama.ProducerMessage
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	for range store.messages {
+		mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			published = append(published, msg)
+			return nil
+		})
+	}
+
+	relay := newOutboxRelay(store, mockProducer, OutboxConfig{}, NewMockLogger())
+	n, err := relay.relay(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{1, 2}, store.sent)
+	if assert.Len(t, published, 2) {
+		key, _ := published[0].Key.Encode()
+		value, _ := published[0].Value.Encode()
+		assert.Equal(t, "a", string(key))
+		assert.Equal(t, `{"id":"a"}`, string(value))
+		assert.Equal(t, "r1", headerMap(published[0].Headers)["x-request-id"])
+	}
+}
+
+func TestOutboxRelayBacksOffFailedMessages(t *testing.T) {
+	store := &fakeOutboxStore{messages: []OutboxMessage{
+		{ID: 7, Topic: "book-log", Payload: []byte(`{}`), Attempts: 2},
+	}}
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageAndFail(errors.New("broker down"))
+
+	relay := newOutboxRelay(store, mockProducer, OutboxConfig{InitialBackoff: time.Second, MaxBackoff: time.Minute}, NewMockLogger())
+	before := time.Now()
+	_, err := relay.relay(context.Background())
+
+	assert.NoError(t, err)
+	assert.Empty(t, store.sent)
+	// third failure: 1s doubled twice
+	assert.WithinDuration(t, before.Add(4*time.Second), store.failed[7], time.Second)
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	config := OutboxConfig{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	assert.Equal(t, time.Second, config.backoff(1))
+	assert.Equal(t, 2*time.Second, config.backoff(2))
+	assert.Equal(t, 8*time.Second, config.backoff(4))
+	assert.Equal(t, 10*time.Second, config.backoff(20))
+}
+
+func TestOutboxRelayStops(t *testing.T) {
+	store := &fakeOutboxStore{}
+	relay := newOutboxRelay(store, mocks.NewSyncProducer(t, nil), OutboxConfig{PollInterval: time.Millisecond}, NewMockLogger())
+
+	relay.start()
+	time.Sleep(5 * time.Millisecond)
+	relay.stop()
+}
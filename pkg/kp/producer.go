@@ -1,10 +1,12 @@
 package kp
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/google/uuid"
 )
 
 type RecordMetadata struct {
@@ -23,84 +25,145 @@ func newProducer(option *KafkaConfig) (sarama.SyncProducer, error) {
 		return option.producer, nil
 	}
 
-	config := sarama.NewConfig()
+	config, err := option.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
 	config.Producer.Return.Successes = true
 	config.Producer.Return.Errors = true
-	config.Version = sarama.V2_5_0_0
-
-	if option.Username != "" && option.Password != "" {
-		config.Net.SASL.Enable = true
-		config.Net.SASL.User = option.Username
-		config.Net.SASL.Password = option.Password
-	}
 
 	return sarama.NewSyncProducer(option.Brokers, config)
 }
 
-func producer(producer sarama.SyncProducer, topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error) {
-	timestamp := time.Now()
+func producer(ctx context.Context, producer sarama.SyncProducer, codec Codec, topic string, payload any, opts ...OptionProducerMsg) (RecordMetadata, error) {
+	msg, err := newProducerMessage(ctx, codec, topic, payload, opts...)
+	if err != nil {
+		return RecordMetadata{}, err
+	}
 
-	data, err := json.Marshal(payload)
+	partition, offset, err := producer.SendMessage(msg)
+	observeProduced(topic, err)
 	if err != nil {
 		return RecordMetadata{}, err
 	}
 
+	return newRecordMetadata(msg, partition, offset), nil
+}
+
+// sendMessages encodes every payload with codec and publishes them to topic
+// in one call of the batch API of the sync producer. The metadata are in the
+// order of the payloads.
+func sendMessages(ctx context.Context, producer sarama.SyncProducer, codec Codec, topic string, payloads []any, opts ...OptionProducerMsg) ([]RecordMetadata, error) {
+	msgs := make([]*sarama.ProducerMessage, 0, len(payloads))
+	for _, payload := range payloads {
+		msg, err := newProducerMessage(ctx, codec, topic, payload, opts...)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+
+	err := producer.SendMessages(msgs)
+
+	failed := make(map[*sarama.ProducerMessage]bool)
+	var errs sarama.ProducerErrors
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			failed[e.Msg] = true
+		}
+	} else if err != nil {
+		for _, msg := range msgs {
+			failed[msg] = true
+		}
+	}
+
+	result := make([]RecordMetadata, 0, len(msgs))
+	for _, msg := range msgs {
+		if failed[msg] {
+			observeProduced(topic, err)
+			result = append(result, RecordMetadata{TopicName: topic, ErrorCode: -1})
+			continue
+		}
+		observeProduced(topic, nil)
+		result = append(result, newRecordMetadata(msg, msg.Partition, msg.Offset))
+	}
+	return result, err
+}
+
+func newProducerMessage(ctx context.Context, codec Codec, topic string, payload any, opts ...OptionProducerMsg) (*sarama.ProducerMessage, error) {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	data, err := codec.Encode(topic, payload)
+	if err != nil {
+		return nil, err
+	}
+
 	msg := &sarama.ProducerMessage{
 		Topic:     topic,
-		Value:     sarama.StringEncoder(data),
-		Timestamp: timestamp,
+		Value:     sarama.ByteEncoder(data),
+		Timestamp: time.Now(),
 	}
 
-	if len(opts) > 0 {
-		for _, opt := range opts {
-			if opt.key != "" {
-				msg.Key = sarama.StringEncoder(opt.key)
-			}
+	for _, opt := range opts {
+		if opt.key != "" {
+			msg.Key = sarama.StringEncoder(opt.key)
+		}
 
-			if len(opt.headers) > 0 {
-				for _, header := range opt.headers {
-					for key, value := range header {
-						msg.Headers = append(msg.Headers, sarama.RecordHeader{
-							Key:   []byte(key),
-							Value: []byte(value),
-						})
-					}
+		if len(opt.headers) > 0 {
+			for _, header := range opt.headers {
+				for key, value := range header {
+					msg.Headers = append(msg.Headers, sarama.RecordHeader{
+						Key:   []byte(key),
+						Value: []byte(value),
+					})
 				}
 			}
+		}
 
-			if !opt.Timestamp.IsZero() {
-				msg.Timestamp = opt.Timestamp
-			}
+		if !opt.Timestamp.IsZero() {
+			msg.Timestamp = opt.Timestamp
+		}
 
-			if opt.Metadata != nil {
-				msg.Metadata = opt.Metadata
-			}
+		if opt.Metadata != nil {
+			msg.Metadata = opt.Metadata
+		}
 
-			if opt.Offset > 0 {
-				msg.Offset = opt.Offset
-			}
+		if opt.Offset > 0 {
+			msg.Offset = opt.Offset
+		}
 
-			if opt.Partition > 0 {
-				msg.Partition = opt.Partition
-			}
+		if opt.Partition > 0 {
+			msg.Partition = opt.Partition
 		}
 	}
 
-	partition, offset, err := producer.SendMessage(msg)
-	if err != nil {
-		return RecordMetadata{}, err
+	if !hasHeader(msg.Headers, HeaderMessageID) {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(HeaderMessageID), Value: []byte(uuid.NewString())})
 	}
 
-	recordMetadata := RecordMetadata{
-		TopicName:      topic,
+	injectTrace(ctx, msg)
+	return msg, nil
+}
+
+func hasHeader(headers []sarama.RecordHeader, key string) bool {
+	for _, h := range headers {
+		if string(h.Key) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func newRecordMetadata(msg *sarama.ProducerMessage, partition int32, offset int64) RecordMetadata {
+	return RecordMetadata{
+		TopicName:      msg.Topic,
 		Partition:      partition,
 		Offset:         offset,
 		ErrorCode:      0,
-		Timestamp:      timestamp.String(),
+		Timestamp:      msg.Timestamp.String(),
 		BaseOffset:     "",
 		LogAppendTime:  "",
 		LogStartOffset: "",
 	}
-
-	return recordMetadata, nil
 }
@@ -0,0 +1,172 @@
+package kp
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// ErrAsyncProducerDisabled is returned by SendMessageAsync when
+// KafkaConfig.Async is not enabled.
+var ErrAsyncProducerDisabled = errors.New("kafka async producer is not enabled")
+
+const defaultAsyncBufferSize = 256
+
+// AsyncProducerConfig enables the async producer used by SendMessageAsync.
+type AsyncProducerConfig struct {
+	Enabled bool `json:"enabled"`
+	// BufferSize bounds the messages waiting for their delivery report,
+	// SendMessageAsync blocks while it is full. Defaults to 256.
+	BufferSize int `json:"bufferSize" validate:"omitempty,min=1"`
+	// OnDelivery is called from a single goroutine with the outcome of every
+	// message sent with SendMessageAsync.
+	OnDelivery func(report DeliveryReport) `json:"-"`
+}
+
+// DeliveryReport is the outcome of a message sent with SendMessageAsync.
+// Metadata is OptionProducerMsg.Metadata of the message.
+type DeliveryReport struct {
+	RecordMetadata
+	Metadata any
+	Err      error
+}
+
+// asyncProducer bounds the in-flight messages of a sarama.AsyncProducer and
+// hands its successes and errors to the delivery callback.
+type asyncProducer struct {
+	producer   sarama.AsyncProducer
+	inFlight   chan struct{}
+	onDelivery func(report DeliveryReport)
+	done       chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// asyncMetadata wraps the metadata of the caller so it comes back with the
+// delivery report.
+type asyncMetadata struct {
+	metadata any
+}
+
+func newAsyncSaramaProducer(option *KafkaConfig) (sarama.AsyncProducer, error) {
+	if option.asyncProducer != nil {
+		return option.asyncProducer, nil
+	}
+
+	config, err := option.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	config.ChannelBufferSize = asyncBufferSize(option.Async)
+
+	return sarama.NewAsyncProducer(option.Brokers, config)
+}
+
+func asyncBufferSize(cfg AsyncProducerConfig) int {
+	if cfg.BufferSize > 0 {
+		return cfg.BufferSize
+	}
+	return defaultAsyncBufferSize
+}
+
+func sendMessageAsync(ctx context.Context, p *asyncProducer, codec Codec, topic string, payload any, opts ...OptionProducerMsg) error {
+	if p == nil {
+		return ErrAsyncProducerDisabled
+	}
+
+	msg, err := newProducerMessage(ctx, codec, topic, payload, opts...)
+	if err != nil {
+		return err
+	}
+	return p.send(ctx, msg)
+}
+
+func newAsyncProducer(producer sarama.AsyncProducer, cfg AsyncProducerConfig) *asyncProducer {
+	p := &asyncProducer{
+		producer:   producer,
+		inFlight:   make(chan struct{}, asyncBufferSize(cfg)),
+		onDelivery: cfg.OnDelivery,
+		done:       make(chan struct{}),
+	}
+	go p.deliveries()
+	return p
+}
+
+// send queues msg, it waits for a free slot while the buffer is full.
+func (p *asyncProducer) send(ctx context.Context, msg *sarama.ProducerMessage) error {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		<-p.inFlight
+		return ErrAsyncProducerDisabled
+	}
+
+	msg.Metadata = asyncMetadata{metadata: msg.Metadata}
+	p.producer.Input() <- msg
+	return nil
+}
+
+func (p *asyncProducer) deliveries() {
+	defer close(p.done)
+
+	successes, errs := p.producer.Successes(), p.producer.Errors()
+	for successes != nil || errs != nil {
+		select {
+		case msg, ok := <-successes:
+			if !ok {
+				successes = nil
+				continue
+			}
+			p.report(msg, nil)
+		case e, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			p.report(e.Msg, e.Err)
+		}
+	}
+}
+
+func (p *asyncProducer) report(msg *sarama.ProducerMessage, err error) {
+	<-p.inFlight
+	observeProduced(msg.Topic, err)
+
+	if p.onDelivery == nil {
+		return
+	}
+	report := DeliveryReport{Err: err}
+	if m, ok := msg.Metadata.(asyncMetadata); ok {
+		report.Metadata = m.metadata
+	}
+	report.RecordMetadata = newRecordMetadata(msg, msg.Partition, msg.Offset)
+	if err != nil {
+		report.ErrorCode = -1
+	}
+	p.onDelivery(report)
+}
+
+// Close flushes the queued messages and waits for their delivery reports.
+func (p *asyncProducer) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.producer.AsyncClose()
+	<-p.done
+}
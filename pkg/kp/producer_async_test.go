@@ -0,0 +1,134 @@
+package kp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendMessages(t *testing.T) {
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageAndSucceed()
+	mockProducer.ExpectSendMessageAndSucceed()
+
+	result, err := sendMessages(context.Background(), mockProducer, JSONCodec{}, topic, []any{
+		map[string]string{"id": "1"},
+		map[string]string{"id": "2"},
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, topic, result[1].TopicName)
+	assert.Equal(t, 0, result[1].ErrorCode)
+}
+
+func TestSendMessagesError(t *testing.T) {
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	mockProducer.ExpectSendMessageAndSucceed()
+
+	result, err := sendMessages(context.Background(), mockProducer, JSONCodec{}, topic, []any{"a", "b"})
+
+	assert.ErrorIs(t, err, sarama.ErrOutOfBrokers)
+	assert.Equal(t, -1, result[0].ErrorCode)
+	assert.Equal(t, -1, result[1].ErrorCode)
+}
+
+func TestAsyncProducerDeliveryReports(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	mockProducer := mocks.NewAsyncProducer(t, config)
+	mockProducer.ExpectInputAndSucceed()
+	mockProducer.ExpectInputAndFail(sarama.ErrOutOfBrokers)
+
+	var mu sync.Mutex
+	reports := make(map[any]DeliveryReport)
+	p := newAsyncProducer(mockProducer, AsyncProducerConfig{
+		Enabled:    true,
+		BufferSize: 1,
+		OnDelivery: func(report DeliveryReport) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports[report.Metadata] = report
+		},
+	})
+
+	assert.NoError(t, sendMessageAsync(context.Background(), p, JSONCodec{}, topic, "first", OptionProducerMsg{Metadata: 1}))
+	assert.NoError(t, sendMessageAsync(context.Background(), p, JSONCodec{}, topic, "second", OptionProducerMsg{Metadata: 2}))
+	p.Close()
+
+	assert.Len(t, reports, 2)
+	assert.NoError(t, reports[1].Err)
+	assert.Equal(t, topic, reports[1].TopicName)
+	assert.ErrorIs(t, reports[2].Err, sarama.ErrOutOfBrokers)
+
+	assert.ErrorIs(t, sendMessageAsync(context.Background(), p, JSONCodec{}, topic, "late"), ErrAsyncProducerDisabled)
+}
+
+func TestSendMessageAsyncDisabled(t *testing.T) {
+	server := &KafkaServer{}
+	assert.ErrorIs(t, server.SendMessageAsync(context.Background(), topic, "payload"), ErrAsyncProducerDisabled)
+}
+
+func TestHttpContextSendMessageAsyncLogs(t *testing.T) {
+	recorder := useTestTracer(t)
+	log := &errorRecordingLogger{MockLogger: NewMockLogger()}
+	app := NewApplication(&Config{AppConfig: AppConfig{Port: "8888", Router: Gin}}, log)
+
+	var err error
+	app.Post("/books", func(ctx IContext) error {
+		ctx.CommonLog("create_book", "book")
+		err = ctx.SendMessageAsync(topic, "payload")
+		return ctx.Response(http.StatusAccepted, nil)
+	})
+	app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/books", nil))
+
+	assert.ErrorIs(t, err, ErrAsyncProducerDisabled)
+	assert.Equal(t, []string{"producer"}, log.summaryLog.errorCmds)
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+	}
+	assert.Contains(t, names, "kafka-producer-"+topic)
+}
+
+func TestCloseProducersOutsideMutex(t *testing.T) {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	mockProducer := mocks.NewAsyncProducer(t, config)
+	mockProducer.ExpectInputAndSucceed()
+
+	release := make(chan struct{})
+	server := &KafkaServer{options: &KafkaConfig{}, log: NewMockLogger()}
+	server.async = newAsyncProducer(mockProducer, AsyncProducerConfig{
+		Enabled: true,
+		OnDelivery: func(report DeliveryReport) {
+			<-release
+			// a callback that calls back into the server during shutdown
+			server.Codec(report.TopicName)
+		},
+	})
+	assert.NoError(t, server.SendMessageAsync(context.Background(), topic, "payload"))
+
+	closed := make(chan struct{})
+	go func() {
+		server.closeProducers()
+		close(closed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("closeProducers deadlocked on the delivery callback")
+	}
+}
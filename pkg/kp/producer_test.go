@@ -1,6 +1,7 @@
 package kp
 
 import (
+	"context"
 	"testing"
 
 	"github.com/IBM/sarama"
@@ -17,7 +18,7 @@ func TestProducer(t *testing.T) {
 
 	mockProducer.ExpectSendMessageAndSucceed() // Expect a successful send
 
-	recordMetadata, err := producer(mockProducer, topic, payload)
+	recordMetadata, err := producer(context.Background(), mockProducer, JSONCodec{}, topic, payload)
 
 	assert.NoError(t, err)
 	assert.Equal(t, topic, recordMetadata.TopicName)
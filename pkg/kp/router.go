@@ -2,15 +2,17 @@ package kp
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type httpApplication struct {
-	router      *gin.Engine
-	middlewares []Middleware
-	cfg         *Config
-	log         ILogger
+	router       *gin.Engine
+	middlewares  []Middleware
+	errorHandler ErrorHandler
+	cfg          *Config
+	log          ILogger
 }
 
 func newServer(cfg *Config, log ILogger) IRouter {
@@ -27,38 +29,49 @@ func newServer(cfg *Config, log ILogger) IRouter {
 }
 
 func (app *httpApplication) Get(path string, handler HandleFunc, middlewares ...Middleware) {
-	// app.router.GET(path, func(c *gin.Context) {
-	// 	preHandle(handler, preMiddleware(app.middlewares, middlewares)...)(newMuxContext(c, &app.cfg.KafkaConfig, app.log))
-	// })
-	app.router.GET(path, app.wrapHandler(handler, middlewares...))
+	app.router.GET(colonPath(path), app.wrapHandler(handler, middlewares...))
 }
 
 func (app *httpApplication) wrapHandler(handler HandleFunc, middlewares ...Middleware) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		preHandle(handler, preMiddleware(app.middlewares, middlewares)...)(newMuxContext(c, &app.cfg.KafkaConfig, app.log))
+		start := time.Now()
+		ctx := newHttpContext(&ginRoute{c: c}, &app.cfg.KafkaConfig, app.log)
+		if err := preHandle(handler, preMiddleware(app.middlewares, middlewares)...)(ctx); err != nil {
+			c.Error(err)
+			handleError(app.errorHandler, ctx, err)
+		}
+		observeHTTP(ctx, start)
 	}
 }
 
 func (app *httpApplication) Post(path string, handler HandleFunc, middlewares ...Middleware) {
-	app.router.POST(path, app.wrapHandler(handler, middlewares...))
+	app.router.POST(colonPath(path), app.wrapHandler(handler, middlewares...))
 }
 
 func (app *httpApplication) Put(path string, handler HandleFunc, middlewares ...Middleware) {
-	app.router.PUT(path, app.wrapHandler(handler, middlewares...))
+	app.router.PUT(colonPath(path), app.wrapHandler(handler, middlewares...))
 }
 
 func (app *httpApplication) Delete(path string, handler HandleFunc, middlewares ...Middleware) {
-	app.router.DELETE(path, app.wrapHandler(handler, middlewares...))
+	app.router.DELETE(colonPath(path), app.wrapHandler(handler, middlewares...))
 }
 
 func (app *httpApplication) Patch(path string, handler HandleFunc, middlewares ...Middleware) {
-	app.router.PATCH(path, app.wrapHandler(handler, middlewares...))
+	app.router.PATCH(colonPath(path), app.wrapHandler(handler, middlewares...))
 }
 
 func (app *httpApplication) Use(middlewares ...Middleware) {
 	app.middlewares = append(app.middlewares, middlewares...)
 }
 
+func (app *httpApplication) Group(prefix string, middlewares ...Middleware) IRouterGroup {
+	return newRouterGroup(app, prefix, middlewares...)
+}
+
+func (app *httpApplication) SetErrorHandler(handler ErrorHandler) {
+	app.errorHandler = handler
+}
+
 func (app *httpApplication) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	app.router.ServeHTTP(w, r)
 }
@@ -71,3 +84,48 @@ func (app *httpApplication) Register() *http.Server {
 
 	return srv
 }
+
+type ginRoute struct {
+	c *gin.Context
+}
+
+func (r *ginRoute) Request() *http.Request {
+	return r.c.Request
+}
+
+func (r *ginRoute) SetRequest(req *http.Request) {
+	r.c.Request = req
+}
+
+func (r *ginRoute) Param(name string) string {
+	return r.c.Param(name)
+}
+
+func (r *ginRoute) Params() map[string]string {
+	params := make(map[string]string, len(r.c.Params))
+	for _, param := range r.c.Params {
+		params[param.Key] = param.Value
+	}
+	return params
+}
+
+func (r *ginRoute) Query(name string) string {
+	return r.c.Query(name)
+}
+
+func (r *ginRoute) GetHeader(key string) string {
+	return r.c.GetHeader(key)
+}
+
+func (r *ginRoute) SetHeader(key, value string) {
+	r.c.Header(key, value)
+}
+
+func (r *ginRoute) JSON(code int, data any) error {
+	r.c.JSON(code, data)
+	return nil
+}
+
+func (r *ginRoute) FullPath() string {
+	return r.c.FullPath()
+}
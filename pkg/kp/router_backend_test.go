@@ -0,0 +1,247 @@
+package kp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var routerBackends = map[string]Router{
+	"gin":   Gin,
+	"mux":   Mux,
+	"echo":  Echo,
+	"fiber": Fiber,
+}
+
+func newBackendApplication(router Router) IApplication {
+	return NewApplication(&Config{
+		AppConfig: AppConfig{
+			Port:   "8888",
+			Router: router,
+		},
+	}, NewMockLogger())
+}
+
+func TestRouterBackendsParamAndQuery(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			var id, q string
+			app.Get("/books/:id", func(ctx IContext) error {
+				id = ctx.Param("id")
+				q = ctx.Query("q")
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/books/42?q=go", nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, printErr(http.StatusOK, rec.Code))
+			assert.Equal(t, "42", id)
+			assert.Equal(t, "go", q)
+		})
+	}
+}
+
+func TestRouterBackendsBracePath(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			var id string
+			app.Delete("/books/{id}", func(ctx IContext) error {
+				id = ctx.Param("id")
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodDelete, "/books/7", nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, printErr(http.StatusOK, rec.Code))
+			assert.Equal(t, "7", id)
+		})
+	}
+}
+
+func TestRouterBackendsReadInputAndResponse(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			app.Post("/books", func(ctx IContext) error {
+				ctx.CommonLog("create_book", "book")
+
+				var data map[string]any
+				if err := ctx.ReadInput(&data); err != nil {
+					return ctx.Response(http.StatusBadRequest, map[string]any{"error": err.Error()})
+				}
+				ctx.SetHeader("x-backend", name)
+				return ctx.Response(http.StatusCreated, data)
+			})
+
+			body := []byte(`{"title":"The Hobbit"}`)
+			req := httptest.NewRequest(http.MethodPost, "/books", bytes.NewReader(body))
+			req.Header.Set(ContentType, ContentTypeJSON)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			var got map[string]any
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+			assert.Equal(t, http.StatusCreated, rec.Code, printErr(http.StatusCreated, rec.Code))
+			assert.Equal(t, "The Hobbit", got["title"])
+			assert.Equal(t, name, rec.Header().Get("x-backend"))
+			assert.Contains(t, rec.Header().Get(ContentType), ContentTypeJSON)
+		})
+	}
+}
+
+func TestRouterBackendsUse(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			middlewareCalled := false
+			app.Use(func(next HandleFunc) HandleFunc {
+				return func(ctx IContext) error {
+					middlewareCalled = true
+					return next(ctx)
+				}
+			})
+			app.Patch("/books/:id", func(ctx IContext) error {
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodPatch, "/books/1", nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.True(t, middlewareCalled, handlerCalledErr)
+		})
+	}
+}
+
+func TestRouterBackendsNoRoute(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			req := httptest.NewRequest(http.MethodGet, "/missing", nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+
+			// the root route matches only the root
+			app.Get("/", func(ctx IContext) error {
+				return ctx.Response(http.StatusOK, "root")
+			})
+
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope/x", nil))
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+		})
+	}
+}
+
+func TestPathConversion(t *testing.T) {
+	assert.Equal(t, "/books/:id/pages/:page", colonPath("/books/{id}/pages/{page}"))
+	assert.Equal(t, "/books/{id}/pages/{page}", bracePath("/books/:id/pages/:page"))
+	assert.Equal(t, "/books", bracePath("/books"))
+}
+
+func TestRouterBackendsGroup(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			var order []string
+			record := func(step string) Middleware {
+				return func(next HandleFunc) HandleFunc {
+					return func(ctx IContext) error {
+						order = append(order, step)
+						return next(ctx)
+					}
+				}
+			}
+
+			app.Use(record("app"))
+			api := app.Group("/api/v1", record("api"))
+			books := api.Group("/books", record("books"))
+			books.Use(record("books-use"))
+
+			var id string
+			books.Get("/:id", func(ctx IContext) error {
+				order = append(order, "handler")
+				id = ctx.Param("id")
+				return nil
+			}, record("route"))
+			books.Get("/", func(ctx IContext) error {
+				order = append(order, "list")
+				return nil
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/books/9", nil)
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, printErr(http.StatusOK, rec.Code))
+			assert.Equal(t, "9", id)
+			assert.Equal(t, []string{"app", "api", "books", "books-use", "route", "handler"}, order)
+
+			order = nil
+			req = httptest.NewRequest(http.MethodGet, "/api/v1/books", nil)
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, printErr(http.StatusOK, rec.Code))
+			assert.Equal(t, []string{"app", "api", "books", "books-use", "list"}, order)
+		})
+	}
+}
+
+func TestRouterBackendsGroupMiddlewareScope(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			denied := func(next HandleFunc) HandleFunc {
+				return func(ctx IContext) error {
+					return ctx.Response(http.StatusUnauthorized, map[string]any{"error": "unauthorized"})
+				}
+			}
+
+			app.Group("/private", denied).Get("/data", func(ctx IContext) error {
+				return nil
+			})
+			app.Get("/public", func(ctx IContext) error {
+				return nil
+			})
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/public", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/private/data", nil))
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		})
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	assert.Equal(t, "/api/v1/books", joinPath("/api/v1/", "/books"))
+	assert.Equal(t, "/api/v1", joinPath("/api/v1", "/"))
+	assert.Equal(t, "/", joinPath("", ""))
+	assert.Equal(t, "/books/:id", joinPath("/books", ":id"))
+}
@@ -0,0 +1,136 @@
+package kp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+type echoApplication struct {
+	router       *echo.Echo
+	middlewares  []Middleware
+	errorHandler ErrorHandler
+	cfg          *Config
+	log          ILogger
+}
+
+func newEchoServer(cfg *Config, log ILogger) IRouter {
+	app := echo.New()
+	app.HideBanner = true
+	app.HidePort = true
+	app.Use(middleware.Recover())
+
+	app.Use(echoOpenTelemetryMiddleware())
+
+	return &echoApplication{
+		router: app,
+		cfg:    cfg,
+		log:    log,
+	}
+}
+
+func (app *echoApplication) wrapHandler(handler HandleFunc, middlewares ...Middleware) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		ctx := newHttpContext(&echoRoute{c: c}, &app.cfg.KafkaConfig, app.log)
+		err := preHandle(handler, preMiddleware(app.middlewares, middlewares)...)(ctx)
+		handleError(app.errorHandler, ctx, err)
+		observeHTTP(ctx, start)
+		return nil
+	}
+}
+
+func (app *echoApplication) Get(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.GET(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *echoApplication) Post(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.POST(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *echoApplication) Put(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.PUT(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *echoApplication) Delete(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.DELETE(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *echoApplication) Patch(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.PATCH(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *echoApplication) Use(middlewares ...Middleware) {
+	app.middlewares = append(app.middlewares, middlewares...)
+}
+
+func (app *echoApplication) Group(prefix string, middlewares ...Middleware) IRouterGroup {
+	return newRouterGroup(app, prefix, middlewares...)
+}
+
+func (app *echoApplication) SetErrorHandler(handler ErrorHandler) {
+	app.errorHandler = handler
+}
+
+func (app *echoApplication) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.router.ServeHTTP(w, r)
+}
+
+func (app *echoApplication) Register() *http.Server {
+	srv := &http.Server{
+		Addr:    ":" + app.cfg.AppConfig.Port,
+		Handler: app.router,
+	}
+
+	return srv
+}
+
+type echoRoute struct {
+	c echo.Context
+}
+
+func (r *echoRoute) Request() *http.Request {
+	return r.c.Request()
+}
+
+func (r *echoRoute) SetRequest(req *http.Request) {
+	r.c.SetRequest(req)
+}
+
+func (r *echoRoute) Param(name string) string {
+	return r.c.Param(name)
+}
+
+func (r *echoRoute) Params() map[string]string {
+	names := r.c.ParamNames()
+	values := r.c.ParamValues()
+	params := make(map[string]string, len(names))
+	for i, name := range names {
+		if i < len(values) {
+			params[name] = values[i]
+		}
+	}
+	return params
+}
+
+func (r *echoRoute) Query(name string) string {
+	return r.c.QueryParam(name)
+}
+
+func (r *echoRoute) GetHeader(key string) string {
+	return r.c.Request().Header.Get(key)
+}
+
+func (r *echoRoute) SetHeader(key, value string) {
+	r.c.Response().Header().Set(key, value)
+}
+
+func (r *echoRoute) JSON(code int, data any) error {
+	return r.c.JSON(code, data)
+}
+
+func (r *echoRoute) FullPath() string {
+	return r.c.Path()
+}
@@ -0,0 +1,149 @@
+package kp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// fiberApplication is the IRouter backed by Fiber. Routes run on Fiber's
+// router, while the application itself is served through net/http so that
+// Server can start and shut it down like every other backend.
+type fiberApplication struct {
+	router       *fiber.App
+	handler      http.HandlerFunc
+	middlewares  []Middleware
+	errorHandler ErrorHandler
+	cfg          *Config
+	log          ILogger
+}
+
+func newFiberServer(cfg *Config, log ILogger) IRouter {
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage: true,
+	})
+	app.Use(recover.New())
+
+	return &fiberApplication{
+		router:  app,
+		handler: adaptor.FiberApp(app),
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (app *fiberApplication) wrapHandler(handler HandleFunc, middlewares ...Middleware) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := adaptor.ConvertRequest(c, true)
+		if err != nil {
+			return err
+		}
+
+		req, span := startHttpSpan(req, c.Route().Path)
+		defer span.End()
+
+		route := &fiberRoute{c: c, req: req}
+		start := time.Now()
+		ctx := newHttpContext(route, &app.cfg.KafkaConfig, app.log)
+		err = preHandle(handler, preMiddleware(app.middlewares, middlewares)...)(ctx)
+		handleError(app.errorHandler, ctx, err)
+		observeHTTP(ctx, start)
+
+		span.SetAttributes(attribute.Int("http.status_code", c.Response().StatusCode()))
+		if err != nil {
+			span.SetAttributes(attribute.Bool("error", true), attribute.String("http.error", err.Error()))
+		}
+		return nil
+	}
+}
+
+func (app *fiberApplication) Get(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.Get(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *fiberApplication) Post(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.Post(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *fiberApplication) Put(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.Put(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *fiberApplication) Delete(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.Delete(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *fiberApplication) Patch(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.router.Patch(colonPath(path), app.wrapHandler(handler, middlewares...))
+}
+
+func (app *fiberApplication) Use(middlewares ...Middleware) {
+	app.middlewares = append(app.middlewares, middlewares...)
+}
+
+func (app *fiberApplication) Group(prefix string, middlewares ...Middleware) IRouterGroup {
+	return newRouterGroup(app, prefix, middlewares...)
+}
+
+func (app *fiberApplication) SetErrorHandler(handler ErrorHandler) {
+	app.errorHandler = handler
+}
+
+func (app *fiberApplication) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.handler(w, r)
+}
+
+func (app *fiberApplication) Register() *http.Server {
+	srv := &http.Server{
+		Addr:    ":" + app.cfg.AppConfig.Port,
+		Handler: app.handler,
+	}
+
+	return srv
+}
+
+type fiberRoute struct {
+	c   *fiber.Ctx
+	req *http.Request
+}
+
+func (r *fiberRoute) Request() *http.Request {
+	return r.req
+}
+
+func (r *fiberRoute) SetRequest(req *http.Request) {
+	r.req = req
+	r.c.SetUserContext(req.Context())
+}
+
+func (r *fiberRoute) Param(name string) string {
+	return r.c.Params(name)
+}
+
+func (r *fiberRoute) Params() map[string]string {
+	return r.c.AllParams()
+}
+
+func (r *fiberRoute) Query(name string) string {
+	return r.c.Query(name)
+}
+
+func (r *fiberRoute) GetHeader(key string) string {
+	return r.req.Header.Get(key)
+}
+
+func (r *fiberRoute) SetHeader(key, value string) {
+	r.c.Set(key, value)
+}
+
+func (r *fiberRoute) JSON(code int, data any) error {
+	return r.c.Status(code).JSON(data)
+}
+
+func (r *fiberRoute) FullPath() string {
+	return r.c.Route().Path
+}
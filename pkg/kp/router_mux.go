@@ -0,0 +1,177 @@
+package kp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// muxApplication is the IRouter backed by the standard library ServeMux and
+// its Go 1.22 "METHOD /path/{param}" patterns.
+type muxApplication struct {
+	router       *http.ServeMux
+	middlewares  []Middleware
+	errorHandler ErrorHandler
+	cfg          *Config
+	log          ILogger
+}
+
+func newMuxServer(cfg *Config, log ILogger) IRouter {
+	return &muxApplication{
+		router: http.NewServeMux(),
+		cfg:    cfg,
+		log:    log,
+	}
+}
+
+func (app *muxApplication) handle(method, path string, handler HandleFunc, middlewares ...Middleware) {
+	pattern := bracePath(path)
+	params := patternParams(pattern)
+
+	// a pattern ending in / matches the whole subtree on ServeMux, {$} keeps
+	// it an exact match like on the other backends
+	exact := pattern
+	if strings.HasSuffix(exact, "/") {
+		exact += "{$}"
+	}
+
+	app.router.HandleFunc(method+" "+exact, func(w http.ResponseWriter, r *http.Request) {
+		r, span := startHttpSpan(r, pattern)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		route := &muxRoute{w: sw, r: r, pattern: pattern, params: params}
+		start := time.Now()
+		ctx := newHttpContext(route, &app.cfg.KafkaConfig, app.log)
+		err := preHandle(handler, preMiddleware(app.middlewares, middlewares)...)(ctx)
+		handleError(app.errorHandler, ctx, err)
+		observeHTTP(ctx, start)
+
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if err != nil {
+			span.SetAttributes(attribute.Bool("error", true), attribute.String("http.error", err.Error()))
+		}
+	})
+}
+
+func (app *muxApplication) Get(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.handle(http.MethodGet, path, handler, middlewares...)
+}
+
+func (app *muxApplication) Post(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.handle(http.MethodPost, path, handler, middlewares...)
+}
+
+func (app *muxApplication) Put(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.handle(http.MethodPut, path, handler, middlewares...)
+}
+
+func (app *muxApplication) Delete(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.handle(http.MethodDelete, path, handler, middlewares...)
+}
+
+func (app *muxApplication) Patch(path string, handler HandleFunc, middlewares ...Middleware) {
+	app.handle(http.MethodPatch, path, handler, middlewares...)
+}
+
+func (app *muxApplication) Use(middlewares ...Middleware) {
+	app.middlewares = append(app.middlewares, middlewares...)
+}
+
+func (app *muxApplication) Group(prefix string, middlewares ...Middleware) IRouterGroup {
+	return newRouterGroup(app, prefix, middlewares...)
+}
+
+func (app *muxApplication) SetErrorHandler(handler ErrorHandler) {
+	app.errorHandler = handler
+}
+
+func (app *muxApplication) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	app.router.ServeHTTP(w, r)
+}
+
+func (app *muxApplication) Register() *http.Server {
+	srv := &http.Server{
+		Addr:    ":" + app.cfg.AppConfig.Port,
+		Handler: app.router,
+	}
+
+	return srv
+}
+
+// patternParams returns the wildcard names of a ServeMux pattern such as "/books/{id}".
+func patternParams(pattern string) []string {
+	var names []string
+	for _, segment := range strings.Split(pattern, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := strings.TrimSuffix(removeBraces(segment), "...")
+			if name != "" && name != "$" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// statusWriter records the status code written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+type muxRoute struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	pattern string
+	params  []string
+}
+
+func (r *muxRoute) Request() *http.Request {
+	return r.r
+}
+
+func (r *muxRoute) SetRequest(req *http.Request) {
+	r.r = req
+}
+
+func (r *muxRoute) Param(name string) string {
+	return r.r.PathValue(name)
+}
+
+func (r *muxRoute) Params() map[string]string {
+	params := make(map[string]string, len(r.params))
+	for _, name := range r.params {
+		params[name] = r.r.PathValue(name)
+	}
+	return params
+}
+
+func (r *muxRoute) Query(name string) string {
+	return r.r.URL.Query().Get(name)
+}
+
+func (r *muxRoute) GetHeader(key string) string {
+	return r.r.Header.Get(key)
+}
+
+func (r *muxRoute) SetHeader(key, value string) {
+	r.w.Header().Set(key, value)
+}
+
+func (r *muxRoute) JSON(code int, data any) error {
+	r.w.Header().Set(ContentType, ContentTypeJSON)
+	r.w.WriteHeader(code)
+	return json.NewEncoder(r.w).Encode(data)
+}
+
+func (r *muxRoute) FullPath() string {
+	return r.pattern
+}
@@ -0,0 +1,160 @@
+package kp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+)
+
+// SubjectName is the subject of the values of topic, "<topic>-value".
+func SubjectName(topic string) string {
+	return topic + "-value"
+}
+
+// SchemaRegistry is a client of a Confluent compatible schema registry. The
+// IDs of registered schemas and the schemas fetched by ID are cached.
+type SchemaRegistry struct {
+	url      string
+	client   *http.Client
+	username string
+	password string
+
+	mu      sync.RWMutex
+	ids     map[string]int
+	schemas map[int]string
+}
+
+type SchemaRegistryOption func(*SchemaRegistry)
+
+// WithSchemaRegistryClient replaces http.DefaultClient.
+func WithSchemaRegistryClient(client *http.Client) SchemaRegistryOption {
+	return func(r *SchemaRegistry) {
+		r.client = client
+	}
+}
+
+// WithSchemaRegistryAuth sets the basic auth credentials of the registry.
+func WithSchemaRegistryAuth(username, password string) SchemaRegistryOption {
+	return func(r *SchemaRegistry) {
+		r.username = username
+		r.password = password
+	}
+}
+
+func NewSchemaRegistry(url string, opts ...SchemaRegistryOption) *SchemaRegistry {
+	r := &SchemaRegistry{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  http.DefaultClient,
+		ids:     make(map[string]int),
+		schemas: make(map[int]string),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Register registers schema under subject and returns its ID. Registering a
+// schema that is already registered returns the existing ID.
+func (r *SchemaRegistry) Register(subject, schema, schemaType string) (int, error) {
+	cacheKey := subject + "\x00" + schemaType + "\x00" + schema
+	r.mu.RLock()
+	id, ok := r.ids[cacheKey]
+	r.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	body := map[string]string{"schema": schema}
+	// the registry defaults to AVRO and older versions reject the field
+	if schemaType != "" && schemaType != SchemaTypeAvro {
+		body["schemaType"] = schemaType
+	}
+
+	var result struct {
+		ID int `json:"id"`
+	}
+	if err := r.do(http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", body, &result); err != nil {
+		return 0, fmt.Errorf("register schema of %s: %w", subject, err)
+	}
+
+	r.mu.Lock()
+	r.ids[cacheKey] = result.ID
+	r.schemas[result.ID] = schema
+	r.mu.Unlock()
+	return result.ID, nil
+}
+
+// Schema returns the schema registered with id.
+func (r *SchemaRegistry) Schema(id int) (string, error) {
+	r.mu.RLock()
+	schema, ok := r.schemas[id]
+	r.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	var result struct {
+		Schema string `json:"schema"`
+	}
+	if err := r.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &result); err != nil {
+		return "", fmt.Errorf("get schema %d: %w", id, err)
+	}
+
+	r.mu.Lock()
+	r.schemas[id] = result.Schema
+	r.mu.Unlock()
+	return result.Schema, nil
+}
+
+func (r *SchemaRegistry) do(method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, r.url+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if body != nil {
+		req.Header.Set(ContentType, schemaRegistryContentType)
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var registryErr struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+		json.NewDecoder(res.Body).Decode(&registryErr)
+		return fmt.Errorf("schema registry returned %d: %s", res.StatusCode, registryErr.Message)
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
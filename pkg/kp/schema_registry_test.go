@@ -0,0 +1,154 @@
+package kp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry is an in-process schema registry serving the register and
+// get-by-ID endpoints.
+type fakeRegistry struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	ids      map[string]int
+	schemas  map[int]string
+	types    map[int]string
+	subjects []string
+	requests atomic.Int32
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	r := &fakeRegistry{ids: make(map[string]int), schemas: make(map[int]string), types: make(map[int]string)}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	w.Header().Set(ContentType, schemaRegistryContentType)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case req.Method == http.MethodPost && strings.HasPrefix(req.URL.Path, "/subjects/") && strings.HasSuffix(req.URL.Path, "/versions"):
+		var body struct {
+			Schema     string `json:"schema"`
+			SchemaType string `json:"schemaType"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Schema == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			json.NewEncoder(w).Encode(map[string]any{"error_code": 42201, "message": "Invalid schema"})
+			return
+		}
+		escaped := strings.TrimSuffix(strings.TrimPrefix(req.URL.EscapedPath(), "/subjects/"), "/versions")
+		subject, err := url.PathUnescape(escaped)
+		if err != nil || strings.Contains(escaped, "/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.subjects = append(r.subjects, subject)
+		id, ok := r.ids[body.Schema]
+		if !ok {
+			id = len(r.ids) + 1
+			r.ids[body.Schema] = id
+			r.schemas[id] = body.Schema
+			r.types[id] = body.SchemaType
+		}
+		json.NewEncoder(w).Encode(map[string]int{"id": id})
+	case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/schemas/ids/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(req.URL.Path, "/schemas/ids/"))
+		schema, ok := r.schemas[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"error_code": 40403, "message": "Schema not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"schema": schema})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSchemaRegistryRegisterCachesID(t *testing.T) {
+	fake := newFakeRegistry(t)
+	registry := NewSchemaRegistry(fake.URL + "/")
+
+	id, err := registry.Register(SubjectName("orders"), `"string"`, SchemaTypeAvro)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	again, err := registry.Register(SubjectName("orders"), `"string"`, SchemaTypeAvro)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+	assert.Equal(t, int32(1), fake.requests.Load())
+
+	// a registered schema is known by ID without asking the registry
+	schema, err := registry.Schema(id)
+	assert.NoError(t, err)
+	assert.Equal(t, `"string"`, schema)
+	assert.Equal(t, int32(1), fake.requests.Load())
+	assert.Equal(t, "", fake.types[id])
+}
+
+func TestSchemaRegistrySendsSchemaType(t *testing.T) {
+	fake := newFakeRegistry(t)
+	registry := NewSchemaRegistry(fake.URL)
+
+	id, err := registry.Register(SubjectName("orders"), `syntax = "proto3";`, SchemaTypeProtobuf)
+	assert.NoError(t, err)
+	assert.Equal(t, SchemaTypeProtobuf, fake.types[id])
+}
+
+func TestSchemaRegistryEscapesSubject(t *testing.T) {
+	fake := newFakeRegistry(t)
+	registry := NewSchemaRegistry(fake.URL)
+
+	subject := "com.example/orders v1?%-value"
+	_, err := registry.Register(subject, `"string"`, SchemaTypeAvro)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{subject}, fake.subjects)
+}
+
+func TestSchemaRegistrySchemaByID(t *testing.T) {
+	fake := newFakeRegistry(t)
+	fake.schemas[7] = `"long"`
+
+	registry := NewSchemaRegistry(fake.URL)
+	schema, err := registry.Schema(7)
+	assert.NoError(t, err)
+	assert.Equal(t, `"long"`, schema)
+
+	_, err = registry.Schema(7)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), fake.requests.Load())
+
+	_, err = registry.Schema(8)
+	assert.ErrorContains(t, err, "Schema not found")
+}
+
+func TestSchemaRegistryAuth(t *testing.T) {
+	var user, pass string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ = r.BasicAuth()
+		json.NewEncoder(w).Encode(map[string]int{"id": 1})
+	}))
+	defer server.Close()
+
+	registry := NewSchemaRegistry(server.URL, WithSchemaRegistryAuth("key", "secret"))
+	_, err := registry.Register("orders-value", `"string"`, SchemaTypeAvro)
+	assert.NoError(t, err)
+	assert.Equal(t, "key", user)
+	assert.Equal(t, "secret", pass)
+}
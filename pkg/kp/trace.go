@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
@@ -17,6 +20,7 @@ import (
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 func startTracing(appName, endpoint string) (*trace.TracerProvider, error) {
@@ -52,6 +56,7 @@ func startTracing(appName, endpoint string) (*trace.TracerProvider, error) {
 	)
 
 	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
 
 	return tracerProvider, nil
 }
@@ -95,3 +100,94 @@ func ginOpenTelemetryMiddleware() gin.HandlerFunc {
 		}
 	}
 }
+
+// startHttpSpan extracts the incoming trace context and starts the server span for a matched route.
+func startHttpSpan(r *http.Request, route string) (*http.Request, oteltrace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	tr := otel.GetTracerProvider().Tracer("gokp-dev")
+	ctx, span := tr.Start(ctx, fmt.Sprintf("%s %s", strings.ToUpper(r.Method), route))
+	return r.WithContext(ctx), span
+}
+
+func echoOpenTelemetryMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req, span := startHttpSpan(c.Request(), c.Path())
+			defer span.End()
+
+			c.SetRequest(req)
+
+			err := next(c)
+
+			span.SetAttributes(attribute.Int("http.status_code", c.Response().Status))
+			if err != nil && !errors.Is(err, io.EOF) {
+				span.SetAttributes(
+					attribute.Bool("error", true),
+					attribute.String("http.error", err.Error()),
+					attribute.String("exception.message", err.Error()),
+					attribute.String("exception.type", fmt.Sprintf("%T", err)),
+				)
+			}
+			return err
+		}
+	}
+}
+
+// producerCarrier lets the propagator write traceparent, tracestate and
+// baggage into the headers of a produced record.
+type producerCarrier struct {
+	msg *sarama.ProducerMessage
+}
+
+func (c producerCarrier) Get(key string) string {
+	for _, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func (c producerCarrier) Set(key, value string) {
+	for i, h := range c.msg.Headers {
+		if string(h.Key) == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+}
+
+func (c producerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, h := range c.msg.Headers {
+		keys = append(keys, string(h.Key))
+	}
+	return keys
+}
+
+// injectTrace writes the trace context of ctx into the record headers.
+func injectTrace(ctx context.Context, msg *sarama.ProducerMessage) {
+	otel.GetTextMapPropagator().Inject(ctx, producerCarrier{msg: msg})
+}
+
+// extractTrace returns a context carrying the trace context of the record
+// headers, the parent of the consumer span.
+func extractTrace(ctx context.Context, headers map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(headers))
+}
+
+// startConsumerSpan starts the span of a consumed record as a child of the
+// trace it was produced in. The span covers every attempt of the handler.
+func startConsumerSpan(message *sarama.ConsumerMessage) (context.Context, oteltrace.Span) {
+	ctx := extractTrace(context.Background(), recordHeaders(message.Headers))
+	return otel.GetTracerProvider().Tracer("gokp").Start(ctx, "kafka-consumer-"+message.Topic,
+		oteltrace.WithSpanKind(oteltrace.SpanKindConsumer),
+		oteltrace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.destination", message.Topic),
+			attribute.Int("messaging.kafka.partition", int(message.Partition)),
+			attribute.Int64("messaging.kafka.offset", message.Offset),
+		),
+	)
+}
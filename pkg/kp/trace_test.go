@@ -0,0 +1,77 @@
+package kp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func useTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+	return recorder
+}
+
+func TestProducerInjectsTraceContext(t *testing.T) {
+	useTestTracer(t)
+	ctx, span := otel.Tracer("test").Start(context.Background(), "http")
+	defer span.End()
+
+	var traceparent string
+	mockProducer := mocks.NewSyncProducer(t, nil)
+	mockProducer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		traceparent = producerCarrier{msg: msg}.Get("traceparent")
+		return nil
+	})
+
+	_, err := producer(ctx, mockProducer, JSONCodec{}, topic, map[string]string{"id": "1"})
+
+	assert.NoError(t, err)
+	assert.Contains(t, traceparent, span.SpanContext().TraceID().String())
+}
+
+func TestConsumeClaimContinuesTrace(t *testing.T) {
+	recorder := useTestTracer(t)
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "http")
+	parent.End()
+
+	msg := &sarama.ProducerMessage{Topic: topic}
+	injectTrace(ctx, msg)
+	message := &sarama.ConsumerMessage{Topic: topic, Value: []byte(`{}`)}
+	for i := range msg.Headers {
+		message.Headers = append(message.Headers, &msg.Headers[i])
+	}
+
+	var handlerSpan oteltrace.Span
+	server := &KafkaServer{producer: mocks.NewSyncProducer(t, nil), log: NewMockLogger()}
+	server.Consume(topic, func(ctx IContext) error {
+		handlerSpan = oteltrace.SpanFromContext(ctx.Context())
+		assert.True(t, handlerSpan.IsRecording(), "consumer span must stay open while the handler runs")
+		return nil
+	})
+
+	_, err := consumeMessages(server, message)
+	assert.NoError(t, err)
+
+	assert.Equal(t, parent.SpanContext().TraceID(), handlerSpan.SpanContext().TraceID())
+	ended := recorder.Ended()
+	consumerSpan := ended[len(ended)-1]
+	assert.Equal(t, "kafka-consumer-"+topic, consumerSpan.Name())
+	assert.Equal(t, parent.SpanContext().SpanID(), consumerSpan.Parent().SpanID())
+}
@@ -16,6 +16,28 @@ func removeBraces(str string) string {
 
 type ContextKey string
 
+// colonPath converts "{id}" path parameters into the ":id" form used by gin, echo and fiber.
+func colonPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + removeBraces(segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// bracePath converts ":id" path parameters into the "{id}" form used by net/http ServeMux.
+func bracePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
 func SetParam(path string, r *http.Request) *http.Request {
 	subPath := strings.Split(path, "/")
 	sss := strings.Split(r.URL.Path, "/")
@@ -52,11 +74,57 @@ func preHandle(final HandleFunc, middlewares ...Middleware) HandleFunc {
 	// This is a confusing and tricky construct :)
 	// We need to use the reverse order since we are chaining inwards.
 	for i := len(middlewares) - 1; i >= 0; i-- {
-		final = middlewares[i](final) // mw1(mw2(mw3(final)))
+		final = chainStep(middlewares[i], final) // mw1(mw2(mw3(final)))
 	}
 	return final
 }
 
+// chainStep wraps a single middleware. The rest of the chain is skipped once a
+// response has been written, and while the middleware runs IContext.Next()
+// invokes the rest of the chain, the same as calling next directly.
+func chainStep(m Middleware, next HandleFunc) HandleFunc {
+	guarded := func(ctx IContext) error {
+		if w, ok := ctx.(interface{ Written() bool }); ok && w.Written() {
+			return nil
+		}
+		return next(ctx)
+	}
+	h := m(guarded)
+
+	return func(ctx IContext) error {
+		c, ok := ctx.(interface {
+			setNext(next HandleFunc) HandleFunc
+		})
+		if !ok {
+			return h(ctx)
+		}
+		prev := c.setNext(guarded)
+		defer c.setNext(prev)
+		return h(ctx)
+	}
+}
+
+// handlerChain holds the rest of the middleware chain for IContext.Next().
+type handlerChain struct {
+	next HandleFunc
+}
+
+func (h *handlerChain) setNext(next HandleFunc) HandleFunc {
+	prev := h.next
+	h.next = next
+	return prev
+}
+
+// run invokes the rest of the chain at most once.
+func (h *handlerChain) run(ctx IContext) error {
+	next := h.next
+	if next == nil {
+		return nil
+	}
+	h.next = nil
+	return next(ctx)
+}
+
 func preMiddleware(app []Middleware, middlewares []Middleware) []Middleware {
 	var m []Middleware
 	if len(app) > 0 {
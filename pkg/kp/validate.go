@@ -0,0 +1,133 @@
+package kp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError describes one field that failed its `validate` tag.
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every field of an input that failed validation.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Message)
+	}
+	return "validation failed: " + strings.Join(messages, ", ")
+}
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+func getValidator() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+		// report fields by their json name, the way the client sent them
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	})
+	return validate
+}
+
+// Validate runs the `validate` struct tags of data, e.g. required, min, max,
+// email, uuid and oneof. Values that are not structs are not validated.
+func Validate(data any) error {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	err := getValidator().Struct(v.Interface())
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	ve := &ValidationError{}
+	for _, fe := range errs {
+		ve.Fields = append(ve.Fields, FieldError{
+			Field:   fieldPath(fe),
+			Tag:     fe.Tag(),
+			Param:   fe.Param(),
+			Message: validationMessage(fe),
+		})
+	}
+	return ve
+}
+
+// fieldPath drops the struct name from the namespace, "Book.author.name" -> "author.name".
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+func validationMessage(fe validator.FieldError) string {
+	field := fieldPath(fe)
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", field)
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", field, fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at most %s characters", field, fe.Param())
+		}
+		return fmt.Sprintf("%s must be at most %s", field, fe.Param())
+	case "len":
+		return fmt.Sprintf("%s must be %s characters long", field, fe.Param())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email", field)
+	case "uuid", "uuid4", "uuid7":
+		return fmt.Sprintf("%s must be a valid UUID", field)
+	case "required_with":
+		return fmt.Sprintf("%s is required when %s is set", field, fe.Param())
+	case "numeric":
+		return fmt.Sprintf("%s must be numeric", field)
+	case "uri":
+		return fmt.Sprintf("%s must be a valid URI", field)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s]", field, fe.Param())
+	default:
+		return fmt.Sprintf("%s failed on the %s rule", field, fe.Tag())
+	}
+}
@@ -0,0 +1,86 @@
+package kp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+type validateInput struct {
+	ID     string `json:"id" validate:"omitempty,uuid"`
+	Name   string `json:"name" validate:"required,min=2,max=5"`
+	Email  string `json:"email" validate:"required,email"`
+	Status string `json:"status" validate:"oneof=active inactive"`
+}
+
+func TestValidate(t *testing.T) {
+	err := Validate(&validateInput{ID: "x", Name: "a", Email: "nope", Status: "gone"})
+
+	var ve *ValidationError
+	assert.True(t, errors.As(err, &ve))
+
+	fields := map[string]string{}
+	for _, f := range ve.Fields {
+		fields[f.Field] = f.Tag
+	}
+	assert.Equal(t, map[string]string{
+		"id":     "uuid",
+		"name":   "min",
+		"email":  "email",
+		"status": "oneof",
+	}, fields)
+
+	assert.NoError(t, Validate(&validateInput{Name: "abc", Email: "a@b.co", Status: "active"}))
+	assert.NoError(t, Validate(&map[string]any{}))
+}
+
+func TestReadInputValidation(t *testing.T) {
+	for name, router := range routerBackends {
+		t.Run(name, func(t *testing.T) {
+			app := newBackendApplication(router)
+
+			app.Post("/users", func(ctx IContext) error {
+				var input validateInput
+				if err := ctx.ReadInput(&input); err != nil {
+					return InvalidInput(err)
+				}
+				return ctx.Response(http.StatusCreated, input)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"status":"active"}`))
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			var body struct {
+				Code    string       `json:"code"`
+				Details []FieldError `json:"details"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Equal(t, "BAD_REQUEST", body.Code)
+			assert.Len(t, body.Details, 2)
+
+			req = httptest.NewRequest(http.MethodPost, "/users", bytes.NewBufferString(`{"name":"bob","email":"bob@example.com","status":"active"}`))
+			rec = httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+		})
+	}
+}
+
+func TestConsumerReadInputValidation(t *testing.T) {
+	ctx := NewConsumerContext(topic, `{"name":"bob","email":"invalid"}`, mocks.NewSyncProducer(t, nil), NewMockLogger())
+
+	var input validateInput
+	err := ctx.ReadInput(&input)
+
+	var ve *ValidationError
+	assert.True(t, errors.As(err, &ve))
+	assert.Equal(t, http.StatusBadRequest, AsError(err).Status)
+}
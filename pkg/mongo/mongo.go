@@ -6,6 +6,8 @@ import (
 	"log"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/sing3demons/go-library-api/pkg/entities"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -15,6 +17,12 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+var operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "mongo_operation_duration_seconds",
+	Help:    "Duration of mongo operations by method and collection.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "collection"})
+
 type SingleResult interface {
 	Decode(any) error
 }
@@ -157,7 +165,8 @@ func (c *mongoCollection) addTrace(ctx context.Context, method, collection strin
 	return ctx, nil
 }
 
-func (c *mongoCollection) sendOperationStats(startTime time.Time, method string, span trace.Span) {
+func (c *mongoCollection) sendOperationStats(startTime time.Time, method, collection string, span trace.Span) {
+	operationDuration.WithLabelValues(method, collection).Observe(time.Since(startTime).Seconds())
 	duration := time.Since(startTime).Microseconds()
 
 	if span != nil {
@@ -214,6 +223,9 @@ func (m *mongoCollection) FindOne(ctx context.Context, filter any, opts ...optio
 
 func (m *mongoCollection) UpdateOne(ctx context.Context, filter, update any, opts ...options.Lister[options.UpdateOneOptions]) (*UpdateResult, error) {
 	r, err := m.coll.UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		return nil, err
+	}
 	return &UpdateResult{
 		MatchedCount:  r.MatchedCount,
 		ModifiedCount: r.ModifiedCount,
@@ -0,0 +1,35 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/sing3demons/go-library-api/pkg/kp"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type processedStore struct {
+	collection Collection
+}
+
+// NewProcessedStore keeps the IDs of the processed Kafka messages as the _id
+// of the documents of collection, see kp.ConsumerOptions. Add a TTL index on
+// processedAt to bound its size.
+func NewProcessedStore(collection Collection) kp.ProcessedStore {
+	return &processedStore{collection: collection}
+}
+
+func (s *processedStore) IsProcessed(ctx context.Context, id string) (bool, error) {
+	n, err := s.collection.CountDocuments(ctx, bson.M{"_id": id}, options.Count().SetLimit(1))
+	return n > 0, err
+}
+
+func (s *processedStore) MarkProcessed(ctx context.Context, id string) error {
+	_, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$setOnInsert": bson.M{"processedAt": time.Now()}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
@@ -38,7 +38,7 @@ func (m *mongoCollection) CreateUser(ctx context.Context, user *entities.User) (
 	result.Body.Options = nil
 	result.Body.Collection = "users"
 	ctx, span := m.addTrace(ctx, result.Body.Method, result.Body.Collection)
-	defer m.sendOperationStats(time.Now(), result.Body.Method, span)
+	defer m.sendOperationStats(time.Now(), result.Body.Method, result.Body.Collection, span)
 
 	jsonDocumentBytes, _ := json.Marshal(user)
 	jsonDocument := strings.ReplaceAll(string(jsonDocumentBytes), `"`, "'")
@@ -66,7 +66,7 @@ func (m *mongoCollection) GetUserByID(ctx context.Context, id string) (entities.
 	result.Body.Collection = "users"
 
 	ctx, span := m.addTrace(ctx, result.Body.Method, result.Body.Collection)
-	defer m.sendOperationStats(time.Now(), result.Body.Method, span)
+	defer m.sendOperationStats(time.Now(), result.Body.Method, result.Body.Collection, span)
 
 	result.RawData = fmt.Sprintf("users.findOne({_id: %s})", id)
 
@@ -87,7 +87,7 @@ func (m *mongoCollection) GetAllUsers(ctx context.Context, filter map[string]any
 
 	result.Body.Collection = "users"
 	ctx, span := m.addTrace(ctx, result.Body.Method, result.Body.Collection)
-	defer m.sendOperationStats(time.Now(), result.Body.Method, span)
+	defer m.sendOperationStats(time.Now(), result.Body.Method, result.Body.Collection, span)
 	opt := &options.FindOptions{}
 
 	result.RawData = buildMongoRawData("users", bson.D{}, opt)
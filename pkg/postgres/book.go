@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/sing3demons/go-library-api/pkg/entities"
+	"github.com/sing3demons/go-library-api/pkg/kp"
 )
 
 func (p *Postgres) GetBookByID(ctx context.Context, id string) (entities.ProcessData[entities.Book], error) {
@@ -21,7 +22,7 @@ func (p *Postgres) GetBookByID(ctx context.Context, id string) (entities.Process
 
 	result.Body.Method = "findOne"
 	ctx, span := p.addTrace(ctx, result.Body.Method, result.Body.Table)
-	defer p.sendOperationStats(time.Now(), result.Body.Method, span)
+	defer p.sendOperationStats(time.Now(), result.Body.Method, result.Body.Table, span)
 
 	rows, err := p.DB.QueryContext(ctx, query, id)
 	if err != nil {
@@ -76,7 +77,7 @@ func (p *Postgres) GetAllBooks(ctx context.Context, filter map[string]any) (resu
 
 	result.Body.Method = "find"
 	ctx, span := p.addTrace(ctx, result.Body.Method, result.Body.Table)
-	defer p.sendOperationStats(time.Now(), result.Body.Method, span)
+	defer p.sendOperationStats(time.Now(), result.Body.Method, result.Body.Table, span)
 
 	rows, err := p.DB.QueryContext(ctx, query, values...)
 	if err != nil {
@@ -98,7 +99,12 @@ func (p *Postgres) GetAllBooks(ctx context.Context, filter map[string]any) (resu
 	return result, nil
 }
 
-func (p *Postgres) CreateBook(ctx context.Context, book entities.Book) (entities.ProcessData[entities.Book], error) {
+// BookEvent builds the outbox message announcing an inserted book.
+type BookEvent func(book entities.Book) (kp.OutboxMessage, error)
+
+// CreateBook inserts book. The messages of events are written to the outbox in
+// the same transaction, they are published only if the book is saved.
+func (p *Postgres) CreateBook(ctx context.Context, book entities.Book, events ...BookEvent) (entities.ProcessData[entities.Book], error) {
 	query := "INSERT INTO books (title, author) VALUES ($1, $2) RETURNING id"
 
 	var result entities.ProcessData[entities.Book]
@@ -107,14 +113,35 @@ func (p *Postgres) CreateBook(ctx context.Context, book entities.Book) (entities
 
 	result.Body.Method = "insert"
 	ctx, span := p.addTrace(ctx, result.Body.Method, result.Body.Table)
-	defer p.sendOperationStats(time.Now(), result.Body.Method, span)
+	defer p.sendOperationStats(time.Now(), result.Body.Method, result.Body.Table, span)
 	result.RawData = strings.Replace(result.RawData, "$1", book.Title, 1)
 	result.RawData = strings.Replace(result.RawData, "$2", book.Author, 1)
 
-	err := p.DB.QueryRowContext(ctx, query, book.Title, book.Author).Scan(&book.ID)
+	tx, err := p.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return result, err
 	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRowContext(ctx, query, book.Title, book.Author).Scan(&book.ID); err != nil {
+		return result, err
+	}
+
+	messages := make([]kp.OutboxMessage, 0, len(events))
+	for _, event := range events {
+		message, err := event(book)
+		if err != nil {
+			return result, err
+		}
+		messages = append(messages, message)
+	}
+	if err := insertOutbox(ctx, tx, messages...); err != nil {
+		return result, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return result, err
+	}
 
 	result.Data = book
 	return result, nil
@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/sing3demons/go-library-api/pkg/kp"
+)
+
+// outboxLease is how long a claimed message stays hidden from other relays,
+// a relay that dies before marking it leaves it to be claimed again.
+var outboxLease = 30 * time.Second
+
+// insertOutbox writes the messages in tx, see init.sql for the outbox table.
+func insertOutbox(ctx context.Context, tx *sql.Tx, messages ...kp.OutboxMessage) error {
+	query := "INSERT INTO outbox (topic, key, headers, payload) VALUES ($1, $2, $3, $4)"
+	for _, m := range messages {
+		headers, err := json.Marshal(m.Headers)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, m.Topic, m.Key, headers, m.Payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Postgres) ClaimOutbox(ctx context.Context, limit int) ([]kp.OutboxMessage, error) {
+	query := `UPDATE outbox SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE sent_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY id LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, topic, key, headers, payload, attempts`
+
+	ctx, span := p.addTrace(ctx, "claim", "outbox")
+	defer p.sendOperationStats(time.Now(), "claim", "outbox", span)
+
+	rows, err := p.DB.QueryContext(ctx, query, limit, time.Now().Add(outboxLease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []kp.OutboxMessage
+	for rows.Next() {
+		var m kp.OutboxMessage
+		var headers []byte
+		if err := rows.Scan(&m.ID, &m.Topic, &m.Key, &headers, &m.Payload, &m.Attempts); err != nil {
+			return nil, err
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &m.Headers); err != nil {
+				return nil, err
+			}
+		}
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the order of the subquery
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+func (p *Postgres) MarkOutboxSent(ctx context.Context, id int64) error {
+	ctx, span := p.addTrace(ctx, "mark_sent", "outbox")
+	defer p.sendOperationStats(time.Now(), "mark_sent", "outbox", span)
+
+	_, err := p.DB.ExecContext(ctx, "UPDATE outbox SET sent_at = NOW(), last_error = NULL WHERE id = $1", id)
+	return err
+}
+
+func (p *Postgres) MarkOutboxFailed(ctx context.Context, id int64, retryAt time.Time, cause error) error {
+	ctx, span := p.addTrace(ctx, "mark_failed", "outbox")
+	defer p.sendOperationStats(time.Now(), "mark_failed", "outbox", span)
+
+	query := "UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3 WHERE id = $1"
+	_, err := p.DB.ExecContext(ctx, query, id, retryAt, cause.Error())
+	return err
+}
@@ -3,17 +3,27 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/sing3demons/go-library-api/pkg/entities"
+	"github.com/sing3demons/go-library-api/pkg/kp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
+var operationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "postgres_operation_duration_seconds",
+	Help:    "Duration of postgres operations by method and table.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "table"})
+
 type Row interface {
 	Scan(dest ...any) error
 }
@@ -29,11 +39,14 @@ type DB interface {
 	// Exec(query string, args ...interface{}) (sql.Result, error)
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) Row
 	QueryContext(ctx context.Context, query string, args ...any) (Rows, error)
+	PingContext(ctx context.Context) error
 	Close() error
 
 	GetBookByID(ctx context.Context, id string) (entities.ProcessData[entities.Book], error)
 	GetAllBooks(ctx context.Context, filter map[string]any) (result entities.ProcessData[[]entities.Book], err error)
-	CreateBook(ctx context.Context, book entities.Book) (entities.ProcessData[entities.Book], error)
+	CreateBook(ctx context.Context, book entities.Book, events ...BookEvent) (entities.ProcessData[entities.Book], error)
+
+	kp.OutboxStore
 }
 
 type Postgres struct {
@@ -41,12 +54,15 @@ type Postgres struct {
 	tracer trace.Tracer
 }
 
-func New() (DB, error) {
-	databaseSource := fmt.Sprintf("host=%s port=%d user=%s "+
-		"password=%s dbname=%s sslmode=disable", "localhost", 5432, "root", "password", "product_master")
+// New connects to the database described by dsn, e.g.
+// "host=localhost port=5432 user=root password=password dbname=product_master sslmode=disable".
+func New(dsn string) (DB, error) {
+	if dsn == "" {
+		return nil, errors.New("postgres: dsn is empty")
+	}
 
 	// otelRegisteredDialect, _ := otelsql.Register("postgres")
-	db, err := sql.Open("postgres", databaseSource)
+	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		log.Fatal(err)
 		return nil, err
@@ -120,7 +136,8 @@ func (c *Postgres) addTrace(ctx context.Context, method, table string) (context.
 	return ctx, nil
 }
 
-func (c *Postgres) sendOperationStats(startTime time.Time, method string, span trace.Span) {
+func (c *Postgres) sendOperationStats(startTime time.Time, method, table string, span trace.Span) {
+	operationDuration.WithLabelValues(method, table).Observe(time.Since(startTime).Seconds())
 	duration := time.Since(startTime).Microseconds()
 
 	if span != nil {
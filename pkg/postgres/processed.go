@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/sing3demons/go-library-api/pkg/kp"
+)
+
+type processedStore struct {
+	db DB
+}
+
+// NewProcessedStore keeps the IDs of the processed Kafka messages in the
+// processed_messages table, see init.sql and kp.ConsumerOptions.
+func NewProcessedStore(db DB) kp.ProcessedStore {
+	return &processedStore{db: db}
+}
+
+func (s *processedStore) IsProcessed(ctx context.Context, id string) (bool, error) {
+	var processed bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM processed_messages WHERE id = $1)", id).Scan(&processed)
+	return processed, err
+}
+
+func (s *processedStore) MarkProcessed(ctx context.Context, id string) error {
+	var inserted string
+	err := s.db.QueryRowContext(ctx, "INSERT INTO processed_messages (id) VALUES ($1) ON CONFLICT (id) DO NOTHING RETURNING id", id).Scan(&inserted)
+	if errors.Is(err, sql.ErrNoRows) {
+		// already marked by a concurrent delivery
+		return nil
+	}
+	return err
+}